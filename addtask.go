@@ -1,142 +1,270 @@
 package litepool
 
 import (
-	"container/heap"
-	"errors"
+	"context"
+	"log/slog"
+	"sync/atomic"
 	"time"
 )
 
+// AddTask 将任务交给协程池，没有空位时等待，最长等待SetAddTimeout设置的时间
+// AddTask hands the task to the pool, waiting for a free slot at most the SetAddTimeout duration.
 func (lp *ListPool) AddTask(opt *TaskOptions) error {
+	return lp.AddTaskContext(context.Background(), opt)
+}
+
+// AddTaskContext 与AddTask相同，ctx取消时立即停止等待并返回ctx.Err()
+// AddTaskContext is like AddTask but stops waiting and returns ctx.Err() as soon as ctx is done.
+func (lp *ListPool) AddTaskContext(ctx context.Context, opt *TaskOptions) error {
 	// 检查任务是否存在
 	// Check if the task is present
-	if opt.task == nil {
-		return errors.New("请添加任务")
-	}
-
-	var n int64
-	add := true
-
-	// 检查是否有空闲的协程可用
-	// Check if there are any idle goroutines available
-	if len(lp.idle) > 0 {
-		n = <-lp.idle
-	} else {
-		// 从堆中尝试获取协程
-		// Try to get a goroutine from the heap
-		w := heap.Pop(lp.heap)
-		// TODO: Limit the number of jobs here
-		if w != nil {
-			add = false
-			_ = <-lp.idleRun // 获取一个空闲协程
-			// Fetch an idle goroutine
-			n = w.(int64)
-		} else {
-			n = -1
-		}
+	if err := lp.check(opt); err != nil {
+		return err
 	}
-
-	// 如果没有等待超时并且没有可用的协程
-	// If there's no wait timeout and no available goroutines
-	if opt.waitTimeOut == 0 && n == -1 {
-		n = <-lp.idleRun
+	lp.begin(ctx, opt)
+	if err := lp.add(ctx, opt); err != nil {
+		lp.giveUp(err, opt)
+		return err
 	}
+	return nil
+}
 
-	// 如果没有可用的协程则使用计时器
-	// Use a timer if no goroutines are available
-	if n == -1 {
-		timer := time.NewTimer(opt.waitTimeOut)
-		defer timer.Stop()
+// add 为已经调用过begin的任务等待空位并分配给协程，没有等到空位时返回错误
+// add waits for a slot for a task that has been through begin and dispatches it, returning an error when no slot is obtained.
+func (lp *ListPool) add(ctx context.Context, opt *TaskOptions) error {
+	// 如果设置了等待时间则使用计时器
+	// Use a timer if a wait timeout is set
+	timeout, stop := waitTimer(opt)
+	defer stop()
+
+	for {
+		if err := lp.acquire(ctx, timeout, opt.priority); err != nil {
+			return err
+		}
 
+		// 将任务发送给选定的协程
+		// Send the task to the selected goroutine
+		if ok, err := lp.submit(opt); ok || err != nil {
+			return err
+		}
+	}
+}
+
+// TryAddTask 与AddTask相同，但不等待空位，没有空位时立即返回ErrPoolFull
+// TryAddTask is like AddTask but does not wait, it returns ErrPoolFull at once when there is no free slot.
+func (lp *ListPool) TryAddTask(opt *TaskOptions) error {
+	if err := lp.check(opt); err != nil {
+		return err
+	}
+	lp.begin(context.Background(), opt)
+	for {
 		select {
-		// 如果没有协程可用则任务超时
-		// Task times out if no goroutine becomes available
-		case <-timer.C:
-			if opt.onTimeout != nil {
-				opt.onTimeout() // 处理超时场景
-				// Handle timeout scenario
-			}
-			if opt.autoDone {
-				opt.tg.wg.Done() // 自动标记任务完成
-				// Automatically mark the task as done
-			}
-			return errors.New("任务超时")
-		// 等待协程变为可用
-		// Wait until a goroutine becomes available
-		case w := <-lp.idleRun:
-			n = w
+		case <-lp.idleRun:
+		default:
+			return ErrPoolFull
+		}
+		if ok, err := lp.submit(opt); ok || err != nil {
+			return err
 		}
 	}
+}
 
-	// 将任务发送给选定的协程
-	// Send the task to the selected goroutine
-	lp.task[n] <- opt
+// check 在提交前检查任务和协程池的状态，协程池关闭后立即失败
+// check validates the task and the pool state before submitting, failing fast once the pool is closed.
+func (lp *ListPool) check(opts ...*TaskOptions) error {
+	select {
+	case <-lp.done:
+		return ErrPoolClosed
+	default:
+	}
+	for _, opt := range opts {
+		if opt == nil || opt.task == nil {
+			return ErrNoTask
+		}
+	}
+	return nil
+}
 
-	// 如果堆中添加了新的协程，更新堆
-	// If a new goroutine was added to the heap, update the heap
-	if add {
-		lp.heap.Add(n)
+// waitTimer 返回等待空位的超时通道，没有设置SetAddTimeout时通道为nil
+// waitTimer returns the timeout channel for waiting on a slot, nil when no SetAddTimeout is set.
+func waitTimer(opts ...*TaskOptions) (<-chan time.Time, func()) {
+	var d time.Duration
+	for _, opt := range opts {
+		if opt.waitTimeOut > 0 && (d == 0 || opt.waitTimeOut < d) {
+			d = opt.waitTimeOut
+		}
 	}
+	if d == 0 {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(d)
+	return timer.C, func() { timer.Stop() }
+}
 
-	return nil
+// acquire 等待一个空位，超时、ctx取消或协程池关闭时返回错误。
+// 没有空位时按照priority排队，空位释放时优先交给优先级高的提交，低优先级的提交同样按排队时间提高优先级。
+// acquire waits for a free slot, returning an error on timeout, ctx cancellation or pool shutdown.
+// Without a free slot it queues by priority, a released slot goes to the highest priority submission first, and low priority submissions age the same way as queued tasks.
+func (lp *ListPool) acquire(ctx context.Context, timeout <-chan time.Time, priority int) error {
+	lp.mutex.Lock()
+	select {
+	case <-lp.idleRun:
+		lp.mutex.Unlock()
+		return nil
+	default:
+	}
+	w := lp.waiters.wait(priority, time.Since(lp.start))
+	lp.mutex.Unlock()
+
+	var err error
+	select {
+	// 等待空位
+	// Wait until a slot is handed over
+	case <-w.ready:
+		return nil
+	// 如果没有协程可用则任务超时
+	// Task times out if no goroutine becomes available
+	case <-timeout:
+		err = ErrSubmitTimeout
+	// 调用者放弃了等待
+	// The caller gave up waiting
+	case <-ctx.Done():
+		err = ctx.Err()
+	// 协程池正在关闭
+	// The pool is shutting down
+	case <-lp.done:
+		err = ErrPoolClosed
+	}
+	lp.mutex.Lock()
+	if !lp.waiters.leave(w) {
+		// 放弃的同时已经取得了空位，交给下一个
+		// A slot was handed over while giving up, pass it on
+		lp.releaseSlot()
+	}
+	lp.mutex.Unlock()
+	return err
 }
 
-type taskGroup struct {
-	n   int64
-	add bool
+// giveUp 处理没有等到空位的任务，超时时执行onTimeout，超时或取消时自动完成任务组
+// giveUp handles a task that did not get a slot, running onTimeout on timeout and marking autoDone groups on timeout or cancellation.
+func (lp *ListPool) giveUp(err error, opt *TaskOptions) {
+	if err == ErrPoolClosed {
+		return
+	}
+	if err == ErrSubmitTimeout {
+		atomic.AddInt64(&lp.submitTimeouts, 1)
+		lp.log(slog.LevelWarn, "task submit timed out", -1, opt, slog.Duration("waited", time.Since(opt.submitted)))
+		lp.emitTask(EventSubmitTimeout, -1, opt, time.Since(opt.submitted), err)
+	}
+	if err == ErrSubmitTimeout && opt.onTimeout != nil {
+		opt.onTimeout() // 处理超时场景
+		// Handle timeout scenario
+	}
+	if opt.autoDone {
+		opt.tg.wg.Done() // 自动标记任务完成
+		// Automatically mark the task as done
+	}
 }
 
-func (lp *ListPool) AddTaskGroup(opts ...*TaskOptions) error {
+// submit 使用已取得的空位分配任务，没有分配成功时归还空位
+// submit dispatches the task with the slot already taken, the slot is given back when it is not dispatched.
+func (lp *ListPool) submit(opt *TaskOptions) (bool, error) {
 	lp.mutex.Lock()
 	defer lp.mutex.Unlock()
+	if lp.close {
+		lp.releaseSlot()
+		return false, ErrPoolClosed
+	}
+	if !lp.dispatch(opt) {
+		lp.releaseSlot()
+		return false, nil
+	}
+	return true, nil
+}
+
+// AddTaskGroup 提交一组任务，先为所有任务预留空位再一起分配，要么全部提交要么全部不提交。
+// 使用任务中最短的SetAddTimeout作为等待时间，任务数超过协程池的最大容量时返回ErrPoolFull。
+// AddTaskGroup submits a group of tasks, reserving slots for all of them before dispatching them together, so either all or none are submitted.
+// The shortest SetAddTimeout among the tasks limits the wait, ErrPoolFull is returned when the group exceeds the pool's maximum capacity.
+func (lp *ListPool) AddTaskGroup(opts ...*TaskOptions) error {
+	return lp.AddTaskGroupContext(context.Background(), opts...)
+}
+
+// AddTaskGroupContext 与AddTaskGroup相同，ctx取消时归还已预留的空位并返回ctx.Err()
+// AddTaskGroupContext is like AddTaskGroup, when ctx is done the reserved slots are given back and ctx.Err() is returned.
+func (lp *ListPool) AddTaskGroupContext(ctx context.Context, opts ...*TaskOptions) error {
 	// 检查任务是否存在
 	// Check if the task is present
+	if err := lp.check(opts...); err != nil {
+		return err
+	}
+	if len(opts) > lp.maxProcess*(lp.jobQueuelen+1) {
+		return ErrPoolFull
+	}
 	for _, opt := range opts {
-		if opt.task == nil {
-			return errors.New("请添加任务")
+		lp.begin(ctx, opt)
+	}
+	timeout, stop := waitTimer(opts...)
+	defer stop()
+	// 任务组按其中最高的优先级等待空位
+	// The group waits for slots with the highest priority among its tasks
+	priority := 0
+	for i, opt := range opts {
+		if i == 0 || opt.priority > priority {
+			priority = opt.priority
 		}
 	}
-	ns := []taskGroup{}
-	for range opts {
-		var n int64
-		add := true
-
-		// 检查是否有空闲的协程可用
-		// Check if there are any idle goroutines available
-		if len(lp.idle) > 0 {
-			n = <-lp.idle
-		} else {
-			// 从堆中尝试获取协程
-			// Try to get a goroutine from the heap
-			w := heap.Pop(lp.heap)
-			// TODO: Limit the number of jobs here
-			if w != nil {
-				add = false
-				_ = <-lp.idleRun // 获取一个空闲协程
-				// Fetch an idle goroutine
-				n = w.(int64)
-			} else {
-				n = -1
+
+	// 一次只允许一个任务组预留空位，否则多个任务组可能各自占用一部分空位而互相等待
+	// Only one group reserves slots at a time, otherwise groups could each hold part of the slots and wait for each other
+	lp.addMutex.Lock()
+	defer lp.addMutex.Unlock()
+	reserved := 0
+	for {
+		for reserved < len(opts) {
+			if err := lp.acquire(ctx, timeout, priority); err != nil {
+				lp.mutex.Lock()
+				lp.unreserve(reserved)
+				lp.mutex.Unlock()
+				for _, opt := range opts {
+					lp.giveUp(err, opt)
+				}
+				return err
 			}
+			lp.mutex.Lock()
+			lp.reserved++
+			lp.mutex.Unlock()
+			reserved++
 		}
 
-		if n == -1 {
-			n = <-lp.idleRun
+		lp.mutex.Lock()
+		if lp.close {
+			lp.unreserve(reserved)
+			lp.mutex.Unlock()
+			return ErrPoolClosed
 		}
-		ns = append(ns, taskGroup{
-			n:   n,
-			add: add,
-		})
-	}
-	for i, n := range ns {
-		// 将任务发送给选定的协程
-		// Send the task to the selected goroutine
-		lp.task[n.n] <- opts[i]
-
-		// 如果堆中添加了新的协程，更新堆
-		// If a new goroutine was added to the heap, update the heap
-		if n.add {
-			lp.heap.Add(n.n)
+		if lack := len(opts) - lp.freeSlots(); lack > 0 {
+			// 部分空位属于正在退出的协程，归还后重新预留
+			// Some slots belong to exiting goroutines, give them back and reserve again
+			lp.unreserve(lack)
+			reserved -= lack
+			lp.mutex.Unlock()
+			continue
+		}
+		for _, opt := range opts {
+			// 将任务发送给选定的协程
+			// Send the task to the selected goroutine
+			lp.dispatch(opt)
 		}
+		lp.reserved -= reserved
+		lp.mutex.Unlock()
+		return nil
 	}
-	return nil
+}
+
+// unreserve 归还任务组预留的空位，调用时需持有lp.mutex
+// unreserve gives back slots reserved by a task group, lp.mutex must be held.
+func (lp *ListPool) unreserve(c int) {
+	lp.reserved -= c
+	lp.addSlots(c)
 }
@@ -0,0 +1,221 @@
+package litepool
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// DelayedTask 是AddTaskAfter或AddTaskAt返回的句柄，到期前可以取消
+// DelayedTask is the handle returned by AddTaskAfter or AddTaskAt, it can be cancelled before it fires.
+type DelayedTask struct {
+	lp  *ListPool
+	opt *TaskOptions
+	at  time.Time // 提交给协程池的时间
+	// Time the task is handed to the pool.
+	index int // 在计时器堆中的位置，到期或取消后为-1
+	// Position in the timer heap, -1 once fired or cancelled.
+	rec *Recurring // 周期任务的计时器，此时opt为nil
+	// Set for the timer of a recurring task, opt is nil then.
+	held bool // 等待重试的任务仍然占用着空位，到期后直接交给协程
+	// The task waiting for a retry still holds its slot and goes straight to a goroutine when due.
+}
+
+// At 返回任务提交给协程池的时间
+// At returns the time the task is handed to the pool.
+func (dt *DelayedTask) At() time.Time {
+	return dt.at
+}
+
+// Cancel 取消还没有到期的任务，返回false表示任务已经提交、已经取消或者协程池已经关闭。
+// 被取消的任务收到ErrTaskCanceled，设置了SetAutoDone时同样会完成任务组。
+// Cancel cancels a task that has not fired yet, false means it was already submitted, cancelled or the pool has shut down.
+// A cancelled task ends with ErrTaskCanceled, and SetAutoDone groups are marked done as well.
+func (dt *DelayedTask) Cancel() bool {
+	lp := dt.lp
+	lp.mutex.Lock()
+	if dt.index < 0 {
+		lp.mutex.Unlock()
+		return false
+	}
+	lp.removeTimer(dt)
+	lp.delayed--
+	lp.mutex.Unlock()
+	lp.giveUp(ErrTaskCanceled, dt.opt)
+	dt.opt.end(ErrTaskCanceled)
+	return true
+}
+
+// AddTaskAfter 在d之后将任务交给协程池，等待空位的方式与AddTask相同。
+// 等待中的任务计入Pending，关闭协程池时作为被放弃的任务由Shutdown返回。
+// AddTaskAfter hands the task to the pool after d, waiting for a slot the same way AddTask does.
+// Waiting tasks count towards Pending and are returned by Shutdown as abandoned tasks when the pool closes.
+func (lp *ListPool) AddTaskAfter(d time.Duration, opt *TaskOptions) (*DelayedTask, error) {
+	return lp.AddTaskAt(time.Now().Add(d), opt)
+}
+
+// AddTaskAt 与AddTaskAfter相同，在t时将任务交给协程池，t已经过去时立即提交
+// AddTaskAt is like AddTaskAfter but hands the task to the pool at t, immediately if t has passed.
+func (lp *ListPool) AddTaskAt(t time.Time, opt *TaskOptions) (*DelayedTask, error) {
+	if err := lp.check(opt); err != nil {
+		return nil, err
+	}
+	dt := &DelayedTask{lp: lp, opt: opt, at: t}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.close {
+		return nil, ErrPoolClosed
+	}
+	lp.delayed++
+	lp.addTimer(dt)
+	return dt, nil
+}
+
+// addTimer 将计时器放入堆中，调用时需持有lp.mutex
+// addTimer puts a timer into the heap, lp.mutex must be held.
+func (lp *ListPool) addTimer(dt *DelayedTask) {
+	heap.Push(lp.timers, dt)
+	if lp.timers.items[0] == dt {
+		// 最早到期的任务变了，唤醒计时协程
+		// The earliest task changed, wake up the timer goroutine
+		select {
+		case lp.timerWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// removeTimer 将还没有到期的计时器从堆中移除，调用时需持有lp.mutex
+// removeTimer takes a timer that has not fired out of the heap, lp.mutex must be held.
+func (lp *ListPool) removeTimer(dt *DelayedTask) {
+	heap.Remove(lp.timers, dt.index)
+}
+
+// runTimers 是协程池的计时协程，将到期的任务交给协程池，协程池关闭时退出
+// runTimers is the timer goroutine of the pool, it hands due tasks to the pool and exits once the pool closes.
+func (lp *ListPool) runTimers() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		lp.mutex.Lock()
+		var wait time.Duration = -1
+		for lp.timers.Len() > 0 {
+			dt := lp.timers.items[0]
+			now := time.Now()
+			if d := dt.at.Sub(now); d > 0 {
+				wait = d
+				break
+			}
+			heap.Pop(lp.timers)
+			if dt.rec != nil {
+				dt.rec.fire()
+				continue
+			}
+			if dt.held {
+				lp.redispatch(dt.opt)
+				continue
+			}
+			lp.delayed--
+			lp.firing.Add(1)
+			go lp.fire(dt.opt)
+		}
+		lp.mutex.Unlock()
+
+		var c <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			c = timer.C
+		}
+		select {
+		case <-c:
+		case <-lp.timerWake:
+			timer.Stop()
+		case <-lp.done:
+			return
+		}
+	}
+}
+
+// fire 提交到期的任务，协程池关闭时将任务作为被放弃的任务交给Shutdown。
+// 没能重新交给协程池的重试与最后一次执行失败一样结束，不按照提交超时处理
+// fire submits a due task, when the pool is closing the task is handed to Shutdown as abandoned.
+// A retry that cannot get back into the pool ends the way a failed last run does rather than as a submit timeout.
+func (lp *ListPool) fire(opt *TaskOptions) {
+	defer lp.firing.Done()
+	if opt.retrying {
+		ctx := context.Background()
+		lp.begin(ctx, opt)
+		if err := lp.add(ctx, opt); err != nil {
+			lp.dropRetry(opt, false, err)
+		}
+		return
+	}
+	err := lp.AddTaskContext(context.Background(), opt)
+	switch err {
+	case nil:
+	case ErrPoolClosed:
+		lp.mutex.Lock()
+		lp.abandoned = append(lp.abandoned, opt)
+		lp.mutex.Unlock()
+		opt.end(err)
+	default:
+		opt.end(err)
+	}
+}
+
+// stopTimers 放弃所有还没有到期的任务并停止周期任务，返回正在等待重试的任务，它们需要在释放lp.mutex后交给dropRetry，调用时需持有lp.mutex
+// stopTimers abandons every task that has not fired yet and stops the recurring tasks, returning the tasks waiting for a retry,
+// which go to dropRetry once lp.mutex is released, lp.mutex must be held.
+func (lp *ListPool) stopTimers() []*DelayedTask {
+	var retries []*DelayedTask
+	for lp.timers.Len() > 0 {
+		dt := heap.Pop(lp.timers).(*DelayedTask)
+		if dt.rec != nil {
+			dt.rec.stop()
+			continue
+		}
+		if !dt.held {
+			lp.delayed--
+		}
+		if dt.opt.retrying {
+			// 已经执行过的任务不算被放弃，作为失败结束
+			// A task that has already run is not abandoned, it ends as a failure
+			retries = append(retries, dt)
+			continue
+		}
+		lp.abandoned = append(lp.abandoned, dt.opt)
+		dt.opt.end(ErrPoolClosed)
+	}
+	return retries
+}
+
+// timerQueue 是按照到期时间排序的延迟任务堆，由lp.mutex保护
+// timerQueue is a heap of delayed tasks ordered by due time, guarded by lp.mutex.
+type timerQueue struct {
+	items []*DelayedTask
+}
+
+func (q *timerQueue) Len() int { return len(q.items) }
+
+func (q *timerQueue) Less(i, j int) bool { return q.items[i].at.Before(q.items[j].at) }
+
+func (q *timerQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	dt := x.(*DelayedTask)
+	dt.index = len(q.items)
+	q.items = append(q.items, dt)
+}
+
+func (q *timerQueue) Pop() interface{} {
+	n := len(q.items)
+	dt := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	dt.index = -1
+	return dt
+}
@@ -0,0 +1,138 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// freeSlotCount 返回当前空闲的空位数
+// freeSlotCount returns the number of free slots right now.
+func freeSlotCount(lp *ListPool) int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return len(lp.idleRun)
+}
+
+// TestAddTaskGroupReservation 任务组没有等到全部空位时归还已预留的空位，等到时一起提交
+// TestAddTaskGroupReservation gives back the reserved slots when a group does not get all of them, and submits it together when it does.
+func TestAddTaskGroupReservation(t *testing.T) {
+	lp := NewPool(2, 1)
+	defer lp.Close()
+	noop := func() error { return nil }
+	if err := lp.AddTaskGroup(newTasks(noop, 5)...); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("group larger than the pool: %v", err)
+	}
+
+	// 占用4个空位中的3个
+	// Take 3 of the 4 slots
+	block := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(2)
+	for i := 0; i < 3; i++ {
+		first := i < 2
+		if err := lp.AddTask(new(TaskOptions).SetTask(func() error {
+			if first {
+				started.Done()
+			}
+			<-block
+			return nil
+		})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	started.Wait()
+
+	opts := newTasks(noop, 2)
+	for _, opt := range opts {
+		opt.SetAddTimeout(20 * time.Millisecond)
+	}
+	if err := lp.AddTaskGroup(opts...); !errors.Is(err, ErrSubmitTimeout) {
+		t.Fatalf("group of 2 with 1 free slot: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lp.AddTaskGroupContext(ctx, newTasks(noop, 2)...); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled group: %v", err)
+	}
+	lp.mutex.Lock()
+	reserved := lp.reserved
+	lp.mutex.Unlock()
+	if reserved != 0 || freeSlotCount(lp) != 1 {
+		t.Fatalf("reserved %d free %d after failed groups", reserved, freeSlotCount(lp))
+	}
+
+	// 空位释放后任务组一起提交
+	// Once the slots are free the group is submitted as a whole
+	var ran int32
+	tg := lp.NewTaskGroup(4)
+	group := make([]*TaskOptions, 4)
+	for i := range group {
+		group[i] = tg.NewTaskOptions().SetAutoDone().SetTask(func() error {
+			atomic.AddInt32(&ran, 1)
+			return nil
+		})
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- lp.AddTaskGroup(group...) }()
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&ran) != 0 {
+		t.Fatal("group started before all of its slots were free")
+	}
+	close(block)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	tg.Wait()
+	if ran != 4 {
+		t.Fatalf("ran %d of 4", ran)
+	}
+}
+
+// TestAddTaskGroupConcurrent 多个任务组同时申请空位时不会互相占用而卡住
+// TestAddTaskGroupConcurrent does not deadlock when several groups reserve slots at the same time.
+func TestAddTaskGroupConcurrent(t *testing.T) {
+	lp := NewPool(2, 1)
+	defer lp.Close()
+	var ran int32
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := lp.AddTaskGroup(newTasks(func() error {
+					time.Sleep(50 * time.Microsecond)
+					atomic.AddInt32(&ran, 1)
+					return nil
+				}, 3)...); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task groups deadlocked")
+	}
+	lp.Shutdown(context.Background(), ShutdownDrain)
+	if ran != 8*20*3 {
+		t.Fatalf("ran %d of %d", ran, 8*20*3)
+	}
+}
+
+// newTasks 创建n个执行task的任务
+// newTasks creates n tasks running task.
+func newTasks(task func() error, n int) []*TaskOptions {
+	opts := make([]*TaskOptions, n)
+	for i := range opts {
+		opts[i] = new(TaskOptions).SetTask(task)
+	}
+	return opts
+}
@@ -5,31 +5,51 @@ import "time"
 const (
 	// 扩充协程池后一定时间内不释放协程池
 	// Duration after which a goroutine pool is not released once expanded
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	TaskQuitCD = time.Second * 10
 
 	// 运行任务的数量和总协程数量的比例大于多少开始自动增加协程
 	// When the ratio of running tasks to total goroutines exceeds this threshold, goroutines are automatically added
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	MinAutoAdd = 0.7
 
 	// 运行任务的数量和总协程数量比例小于多少开始释放协程
 	// When the ratio of running tasks to total goroutines is below this threshold, goroutines are automatically released
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	MaxAutoQuit = 0.3
 
 	// 每次自动新增协程池对于总数的比例
 	// The ratio of the number of goroutines added automatically to the total number of goroutines each time
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	AutoAddScale = 0.1
 
 	// 每次自动退出协程池的比例
 	// The ratio of goroutines that are automatically exited from the pool each time
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	AutoQuitScale = 0.1
 
 	// 自动检测缩放的时间
 	// Time interval for automatic scale checks
-	// Note: This is for future auto-scaling of goroutine pool, not implemented in the current version
+	// Note: Only used when the pool is created with WithMinProcess smaller than maxProcess
 	AutoCheckScaleTime = time.Second * 1
+
+	// 任务每排队多久优先级相当于提高1，避免低优先级的任务一直排不到
+	// Every this long a task waits counts as one extra priority level, so low priority tasks do not starve
+	PriorityAging = time.Second * 1
+
+	// LatencyAwareDispatcher计算平均执行时间时最新一次的权重
+	// Weight of the latest run in the moving average of LatencyAwareDispatcher
+	LatencyAlpha = 0.2
+
+	// DefaultRetryPolicy最多执行的次数，包括第一次
+	// Maximum number of runs of DefaultRetryPolicy, the first one included
+	RetryAttempts = 3
+
+	// DefaultRetryPolicy第一次重试前等待的时间，之后每次翻倍
+	// Wait of DefaultRetryPolicy before the first retry, doubled after every retry
+	RetryBackoff = time.Millisecond * 100
+
+	// DefaultRetryPolicy最长等待的时间
+	// Longest wait of DefaultRetryPolicy between retries
+	RetryMaxBackoff = time.Second * 30
 )
@@ -0,0 +1,324 @@
+package litepool
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxAttemptRecords 是每个任务最多保留的执行记录数，超过时丢弃最早的记录
+// maxAttemptRecords is the number of runs recorded per task, the oldest records are dropped beyond it.
+const maxAttemptRecords = 64
+
+// DeadLetterAttempt 是任务的一次执行记录
+// DeadLetterAttempt records one run of a task.
+type DeadLetterAttempt struct {
+	Worker   int64         `json:"worker"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error"`
+	Panic    bool          `json:"panic,omitempty"`
+	Err      error         `json:"-"` // 执行返回的错误，从文件读取时为nil
+	// Error returned by the run, nil when read from a file.
+}
+
+// DeadLetter 是以错误结束的任务，包括没有重试、用尽重试、panic和等待重试时协程池关闭的任务
+// DeadLetter is a task that ended with an error, whether it had no retries, ran out of them, panicked or was waiting for a retry when the pool closed.
+type DeadLetter struct {
+	Task *TaskOptions `json:"-"` // 原来的任务，从文件读取时为nil，需要自己重新设置后才能Resubmit
+	// The original task, nil when read from a file, set it again before calling Resubmit.
+	ID        uint64            `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Pool      string            `json:"pool,omitempty"`
+	Priority  int               `json:"priority,omitempty"`
+	Submitted time.Time         `json:"submitted"` // 第一次提交的时间
+	// Time of the first submission.
+	Failed time.Time  `json:"failed"`
+	Class  ErrorClass `json:"class,omitempty"`
+	Error  string     `json:"error"`
+	Err    error      `json:"-"` // 最后一次执行的错误，从文件读取时为nil
+	// Error of the last run, nil when read from a file.
+	Attempts []DeadLetterAttempt `json:"attempts"` // 每一次执行的记录，最多保留最近的64次
+	// Record of every run, the latest 64 are kept.
+}
+
+// DeadLetterSink 接收以错误结束的任务，Put在执行任务的协程中调用
+// DeadLetterSink receives the tasks that ended with an error, Put is called on the goroutine that ran the task.
+type DeadLetterSink interface {
+	Put(dl *DeadLetter) error
+}
+
+// WithDeadLetter 设置协程池的死信队列，每个以错误结束的任务都会交给它，不论是否设置了重试，也不论onError是否处理了错误；
+// ErrReload安排的重试只在最终失败时交给它，关闭时被放弃的任务不会交给它。设置后会记录每个任务每一次执行的时间和错误。
+// WithDeadLetter sets the dead-letter sink of the pool. Every task that ends with an error goes to it, with or without retries and whether or not onError handled the error;
+// a retry scheduled by ErrReload only goes to it once it fails for good, and tasks abandoned on close never do. The pool then records the time and error of every run of every task.
+func WithDeadLetter(sink DeadLetterSink) PoolOption {
+	return func(lp *ListPool) {
+		lp.deadLetters = sink
+	}
+}
+
+// Resubmit 以新的任务ID重新提交死信中的任务，等待空位的方式与AddTask相同，成功后从协程池的死信队列中移除它。
+// 返回的错误只表示提交是否成功，移除失败时只记录一条警告日志，死信留在队列中。
+// 任务的回调会再次执行，但不会再完成Future或TaskGroup.GoTask等待的结果，也不会自动完成任务组。
+// Resubmit submits the task of a dead letter again under a new task ID, waiting for a slot the way AddTask does, and removes it from the pool's sink once submitted.
+// The returned error only tells whether it was submitted, a failed removal is logged as a warning and leaves the dead letter in the sink.
+// The callbacks of the task run again, but it no longer completes a Future or a TaskGroup.GoTask result, nor marks its group done automatically.
+func (lp *ListPool) Resubmit(dl *DeadLetter) error {
+	if dl.Task == nil {
+		return ErrNoTask
+	}
+	opt := dl.Task.clone()
+	opt.onFinish = nil
+	opt.autoDone = false
+	if err := lp.AddTask(opt); err != nil {
+		return err
+	}
+	if r, ok := lp.deadLetters.(interface{ Remove(dl *DeadLetter) error }); ok {
+		if err := r.Remove(dl); err != nil {
+			// 任务已经提交，返回错误会让调用者再提交一次
+			// The task is already submitted, returning the error would make the caller submit it twice
+			lp.log(slog.LevelWarn, "dead letter not removed", -1, dl.Task, slog.Any("error", err))
+		}
+	}
+	return nil
+}
+
+// recordAttempt 记录任务的一次执行，没有设置死信队列时不记录
+// recordAttempt records one run of the task, nothing is recorded without a dead-letter sink.
+func (lp *ListPool) recordAttempt(n int64, f *TaskOptions, start time.Time, d time.Duration, err error, panicked bool) {
+	if lp.deadLetters == nil {
+		return
+	}
+	a := DeadLetterAttempt{Worker: n, Start: start, Duration: d, Panic: panicked, Err: err}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if len(f.attempts) >= maxAttemptRecords {
+		f.attempts = append(f.attempts[:0], f.attempts[1:]...)
+	}
+	f.attempts = append(f.attempts, a)
+}
+
+// deadLetter 将以错误结束的任务交给死信队列
+// deadLetter hands a task that ended with an error to the dead-letter sink.
+func (lp *ListPool) deadLetter(n int64, f *TaskOptions, err error) {
+	if lp.deadLetters == nil {
+		return
+	}
+	dl := &DeadLetter{
+		Task:      f,
+		ID:        f.id,
+		Name:      f.name,
+		Labels:    f.labels,
+		Pool:      lp.name,
+		Priority:  f.priority,
+		Submitted: f.firstSubmitted,
+		Failed:    time.Now(),
+		Class:     lp.classify(f, err),
+		Error:     err.Error(),
+		Err:       err,
+		Attempts:  f.attempts,
+	}
+	f.attempts = nil
+	if perr := lp.deadLetters.Put(dl); perr != nil {
+		lp.log(slog.LevelWarn, "dead letter dropped", n, f, slog.Any("error", err), slog.Any("sink_error", perr))
+	}
+}
+
+// MemoryDeadLetters 是保存在内存中的死信队列，limit>0时只保留最近的limit个任务
+// MemoryDeadLetters is an in-memory dead-letter sink, only the latest limit tasks are kept when limit>0.
+type MemoryDeadLetters struct {
+	mutex sync.Mutex
+	limit int
+	items []*DeadLetter
+}
+
+// NewMemoryDeadLetters 创建最多保留limit个任务的内存死信队列，limit<1时不限制
+// NewMemoryDeadLetters creates an in-memory sink keeping up to limit tasks, no limit when limit<1.
+func NewMemoryDeadLetters(limit int) *MemoryDeadLetters {
+	return &MemoryDeadLetters{limit: limit}
+}
+
+func (m *MemoryDeadLetters) Put(dl *DeadLetter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.limit > 0 && len(m.items) >= m.limit {
+		m.items = append(m.items[:0], m.items[len(m.items)-m.limit+1:]...)
+	}
+	m.items = append(m.items, dl)
+	return nil
+}
+
+// List 按照失败的先后返回所有死信
+// List returns every dead letter in the order the tasks failed.
+func (m *MemoryDeadLetters) List() []*DeadLetter {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]*DeadLetter(nil), m.items...)
+}
+
+// Len 返回死信的数量
+// Len returns the number of dead letters.
+func (m *MemoryDeadLetters) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.items)
+}
+
+// Remove 移除一个死信
+// Remove removes a dead letter.
+func (m *MemoryDeadLetters) Remove(dl *DeadLetter) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, item := range m.items {
+		if item == dl {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// FileDeadLetters 将死信以JSON Lines格式追加到文件中，每行一个任务，进程重启后仍然可以查看。
+// 任务本身无法写入文件，只有本进程写入的死信在List时带有Task。
+// FileDeadLetters appends dead letters to a file in the JSON Lines format, one task per line, so they survive a restart.
+// The task itself cannot be written to the file, only dead letters written by this process come back from List with their Task.
+type FileDeadLetters struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	tasks map[deadLetterKey]*TaskOptions
+}
+
+// deadLetterKey 区分文件中的死信，任务ID在进程重启后会重复
+// deadLetterKey tells the dead letters of a file apart, task IDs repeat after a restart.
+type deadLetterKey struct {
+	id     uint64
+	failed int64
+}
+
+func keyOf(dl *DeadLetter) deadLetterKey {
+	return deadLetterKey{id: dl.ID, failed: dl.Failed.UnixNano()}
+}
+
+// NewFileDeadLetters 打开或创建path作为死信文件
+// NewFileDeadLetters opens or creates path as the dead-letter file.
+func NewFileDeadLetters(path string) (*FileDeadLetters, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeadLetters{path: path, file: file, tasks: map[deadLetterKey]*TaskOptions{}}, nil
+}
+
+func (fd *FileDeadLetters) Put(dl *DeadLetter) error {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	if _, err := fd.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if dl.Task != nil {
+		fd.tasks[keyOf(dl)] = dl.Task
+	}
+	return nil
+}
+
+// List 读取文件中的所有死信
+// List reads every dead letter in the file.
+func (fd *FileDeadLetters) List() ([]*DeadLetter, error) {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	return fd.read()
+}
+
+// Remove 从文件中移除一个死信，文件会被重写
+// Remove removes a dead letter from the file, which is rewritten.
+func (fd *FileDeadLetters) Remove(dl *DeadLetter) error {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	items, err := fd.read()
+	if err != nil {
+		return err
+	}
+	key := keyOf(dl)
+	tmp, err := os.CreateTemp(filepath.Dir(fd.path), ".deadletters-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if keyOf(item) == key {
+			continue
+		}
+		if err = enc.Encode(item); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		// CreateTemp创建的文件权限为0600，改回原来文件的权限
+		// CreateTemp creates the file with mode 0600, restore the mode of the original file
+		var info os.FileInfo
+		if info, err = fd.file.Stat(); err == nil {
+			err = tmp.Chmod(info.Mode().Perm())
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fd.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	delete(fd.tasks, key)
+	// 文件被替换，重新打开
+	// The file was replaced, open it again
+	fd.file.Close()
+	fd.file, err = os.OpenFile(fd.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+// Close 关闭死信文件
+// Close closes the dead-letter file.
+func (fd *FileDeadLetters) Close() error {
+	fd.mutex.Lock()
+	defer fd.mutex.Unlock()
+	return fd.file.Close()
+}
+
+// read 读取文件中的死信，调用时需持有fd.mutex
+// read reads the dead letters of the file, fd.mutex must be held.
+func (fd *FileDeadLetters) read() ([]*DeadLetter, error) {
+	file, err := os.Open(fd.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var items []*DeadLetter
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		dl := new(DeadLetter)
+		if err := dec.Decode(dl); err != nil {
+			return items, err
+		}
+		dl.Task = fd.tasks[keyOf(dl)]
+		items = append(items, dl)
+	}
+	return items, nil
+}
@@ -0,0 +1,247 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestDeadLetterSink 每个以错误结束的任务都交给死信队列，成功的任务不会
+// TestDeadLetterSink hands every task that ends with an error to the sink and no successful one.
+func TestDeadLetterSink(t *testing.T) {
+	errBad := errors.New("bad")
+	tests := []struct {
+		name     string
+		opt      func() *TaskOptions
+		task     func(runs int32) error
+		attempts int // 0表示不交给死信队列
+		// 0 means it does not reach the sink
+		panicked bool
+	}{
+		{"success", func() *TaskOptions { return new(TaskOptions) }, func(int32) error { return nil }, 0, false},
+		{"error", func() *TaskOptions { return new(TaskOptions) }, func(int32) error { return errBad }, 1, false},
+		{"error handled by onError", func() *TaskOptions {
+			return new(TaskOptions).SetOnError(func(h *ErrHandle, g *TaskGroup, err error) {})
+		}, func(int32) error { return errBad }, 1, false},
+		{"panic", func() *TaskOptions { return new(TaskOptions) }, func(int32) error { panic("boom") }, 1, true},
+		{"retries exhausted", func() *TaskOptions {
+			return new(TaskOptions).SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+		}, func(int32) error { return errBad }, 3, false},
+		{"success after a retry", func() *TaskOptions {
+			return new(TaskOptions).SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+		}, func(runs int32) error {
+			if runs < 2 {
+				return errBad
+			}
+			return nil
+		}, 0, false},
+		{"ErrReload exhausted", func() *TaskOptions {
+			return new(TaskOptions).SetOnError(func(h *ErrHandle, g *TaskGroup, err error) {
+				h.ErrReload(2, func(error) {})
+			})
+		}, func(int32) error { return errBad }, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewMemoryDeadLetters(0)
+			lp := NewPool(1, 1, WithDeadLetter(sink), WithName("dl"))
+			defer lp.Close()
+			var runs int32
+			opt := tt.opt().SetName(tt.name).SetLabels(map[string]string{"case": tt.name})
+			SubmitTask(lp, opt, func(ctx context.Context) (struct{}, error) {
+				return struct{}{}, tt.task(atomic.AddInt32(&runs, 1))
+			}).Get(context.Background())
+			if tt.attempts == 0 {
+				if sink.Len() != 0 {
+					t.Fatalf("%d dead letters, want none", sink.Len())
+				}
+				return
+			}
+			list := sink.List()
+			if len(list) != 1 {
+				t.Fatalf("%d dead letters, want 1", len(list))
+			}
+			dl := list[0]
+			if dl.Task != opt || dl.ID != opt.ID() || dl.Name != tt.name || dl.Labels["case"] != tt.name || dl.Pool != "dl" {
+				t.Fatalf("dead letter %+v does not describe the task", dl)
+			}
+			if dl.Submitted.IsZero() || dl.Failed.Before(dl.Submitted) || dl.Err == nil || dl.Error != dl.Err.Error() {
+				t.Fatalf("submitted %v failed %v error %q %v", dl.Submitted, dl.Failed, dl.Error, dl.Err)
+			}
+			if len(dl.Attempts) != tt.attempts {
+				t.Fatalf("%d attempts recorded, want %d", len(dl.Attempts), tt.attempts)
+			}
+			last := dl.Attempts[len(dl.Attempts)-1]
+			if last.Panic != tt.panicked || last.Err == nil || last.Error != last.Err.Error() || last.Start.IsZero() {
+				t.Fatalf("last attempt %+v", last)
+			}
+		})
+	}
+}
+
+// TestMemoryDeadLettersLimit limit>0时只保留最近的limit个死信
+// TestMemoryDeadLettersLimit keeps only the latest limit dead letters when limit>0.
+func TestMemoryDeadLettersLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  []uint64
+	}{
+		{0, []uint64{1, 2, 3, 4}},
+		{1, []uint64{4}},
+		{3, []uint64{2, 3, 4}},
+		{10, []uint64{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		m := NewMemoryDeadLetters(tt.limit)
+		for id := uint64(1); id <= 4; id++ {
+			m.Put(&DeadLetter{ID: id})
+		}
+		var got []uint64
+		for _, dl := range m.List() {
+			got = append(got, dl.ID)
+		}
+		if len(got) != len(tt.want) || m.Len() != len(tt.want) {
+			t.Fatalf("limit %d: kept %v, want %v", tt.limit, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("limit %d: kept %v, want %v", tt.limit, got, tt.want)
+			}
+		}
+	}
+}
+
+// TestFileDeadLetters 死信按行写入文件，Remove重写文件并保留权限，重新打开后死信没有任务本身
+// TestFileDeadLetters writes one dead letter per line, Remove rewrites the file keeping its mode, and after reopening the dead letters have no task.
+func TestFileDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	fd, err := NewFileDeadLetters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	failed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	task := new(TaskOptions)
+	// ID在进程重启后会重复，1和2用失败时间区分
+	// IDs repeat after a restart, 1 and 2 are told apart by their failure time
+	letters := []*DeadLetter{
+		{ID: 7, Failed: failed, Error: "first", Class: ClassRetryable, Task: task,
+			Attempts: []DeadLetterAttempt{{Worker: 0, Start: failed, Duration: time.Second, Error: "first"}}},
+		{ID: 7, Failed: failed.Add(time.Hour), Error: "second"},
+		{ID: 8, Failed: failed, Error: "third", Labels: map[string]string{"tenant": "a"}},
+	}
+	for _, dl := range letters {
+		if err := fd.Put(dl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := fd.List()
+	if err != nil || len(items) != 3 {
+		t.Fatalf("List: %d items, %v", len(items), err)
+	}
+	if items[0].Task != task || items[1].Task != nil || items[0].Class != ClassRetryable || items[2].Labels["tenant"] != "a" {
+		t.Fatalf("read back %+v %+v %+v", items[0], items[1], items[2])
+	}
+	if a := items[0].Attempts; len(a) != 1 || a[0].Duration != time.Second || !a[0].Start.Equal(failed) || a[0].Err != nil {
+		t.Fatalf("attempts read back as %+v", a)
+	}
+
+	if err := fd.Remove(items[0]); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("mode after Remove %v, %v", info.Mode(), err)
+	}
+	// Remove之后仍然可以追加
+	// Put still appends after Remove
+	if err := fd.Put(&DeadLetter{ID: 9, Failed: failed, Error: "fourth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err = NewFileDeadLetters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	items, err = fd.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, dl := range items {
+		if dl.Task != nil {
+			t.Fatalf("dead letter %d has a task after reopening", dl.ID)
+		}
+		got = append(got, dl.Error)
+	}
+	if strings.Join(got, ",") != "second,third,fourth" {
+		t.Fatalf("reopened file has %v", got)
+	}
+}
+
+// failingRemove 是Remove总是失败的死信队列
+// failingRemove is a dead-letter sink whose Remove always fails.
+type failingRemove struct {
+	*MemoryDeadLetters
+}
+
+func (failingRemove) Remove(*DeadLetter) error { return errors.New("read-only") }
+
+// TestResubmit 重新提交死信中的任务后将它从死信队列中移除，移除失败只记录警告，提交失败时死信留在队列中
+// TestResubmit removes the dead letter once its task is submitted again, a failed removal is only logged and a failed submission keeps the dead letter.
+func TestResubmit(t *testing.T) {
+	var buf lockedBuffer
+	sink := NewMemoryDeadLetters(0)
+	lp := NewPool(1, 1, WithDeadLetter(sink), WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	var runs int32
+	done := make(chan error, 4)
+	opt := new(TaskOptions).SetTask(func() error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return errors.New("first run")
+		}
+		return nil
+	}).SetOnComplete(func() { done <- nil })
+	lp.AddTask(opt)
+	<-done
+	dl := sink.List()[0]
+
+	if err := lp.Resubmit(dl); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if atomic.LoadInt32(&runs) != 2 || sink.Len() != 0 {
+		t.Fatalf("runs %d, %d dead letters left", runs, sink.Len())
+	}
+	if err := lp.Resubmit(&DeadLetter{ID: 1}); err != ErrNoTask {
+		t.Fatalf("Resubmit without a task: %v", err)
+	}
+
+	// 提交成功时不返回移除的错误，否则调用者会再提交一次
+	// A successful submission does not return the removal error, the caller would submit it again
+	lp.deadLetters = failingRemove{sink}
+	sink.Put(dl)
+	if err := lp.Resubmit(dl); err != nil {
+		t.Fatalf("Resubmit returned %v", err)
+	}
+	<-done
+	if sink.Len() != 1 || !strings.Contains(buf.String(), `msg="dead letter not removed"`) || !strings.Contains(buf.String(), "error=read-only") {
+		t.Fatalf("%d dead letters, log:\n%s", sink.Len(), buf.String())
+	}
+
+	lp.deadLetters = sink
+	lp.Close()
+	if err := lp.Resubmit(dl); err != ErrPoolClosed || sink.Len() != 1 {
+		t.Fatalf("Resubmit on a closed pool: %v, %d dead letters", err, sink.Len())
+	}
+}
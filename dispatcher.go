@@ -0,0 +1,348 @@
+package litepool
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+)
+
+// Dispatcher 选择接收任务的协程，通过WithDispatcher为每个协程池单独设置，默认为NewLeastLoadedDispatcher。
+// 所有方法都在持有协程池的锁时调用，因此不需要自己加锁，也不能在多个协程池之间共用。
+// 协程的负载是它排队和正在执行的任务数，达到capacity时不能再接收任务。
+// Dispatcher picks the goroutine that receives a task, it is set per pool with WithDispatcher and NewLeastLoadedDispatcher is the default.
+// Every method is called with the pool's lock held, so it needs no locking of its own and must not be shared between pools.
+// The load of a goroutine is the number of its queued and executing tasks, it takes no more tasks once that reaches capacity.
+type Dispatcher interface {
+	// Init 在创建协程池时调用，协程编号为0到maxWorkers-1
+	// Init is called when the pool is created, goroutines are numbered 0 to maxWorkers-1.
+	Init(maxWorkers, capacity int)
+	// Add 协程n开始接收任务，此时负载为0
+	// Add: goroutine n starts taking tasks with a load of 0.
+	Add(n int64)
+	// Remove 协程n不再接收任务
+	// Remove: goroutine n takes no more tasks.
+	Remove(n int64)
+	// Update 协程n的负载变为load，也会对已经Remove的协程调用
+	// Update: the load of goroutine n changed to load, it is also called for goroutines already removed.
+	Update(n int64, load int)
+	// Pick 返回接收下一个任务的协程，所有协程都已满时返回false
+	// Pick returns the goroutine for the next task, false when every goroutine is full.
+	Pick() (int64, bool)
+}
+
+// ExecTimeRecorder 可以由Dispatcher实现，每个任务执行完后协程池在持有锁时调用RecordExec，d为任务的执行时间
+// ExecTimeRecorder may be implemented by a Dispatcher, the pool calls RecordExec with its lock held after every task, d being the execution time.
+type ExecTimeRecorder interface {
+	RecordExec(n int64, d time.Duration)
+}
+
+// WithDispatcher 设置协程池选择协程的方式
+// WithDispatcher sets how the pool picks goroutines for tasks.
+func WithDispatcher(d Dispatcher) PoolOption {
+	return func(lp *ListPool) {
+		if d != nil {
+			lp.dispatcher = d
+		}
+	}
+}
+
+// workerSet 记录接收任务的协程和所有协程的负载，供各个Dispatcher使用
+// workerSet records the goroutines taking tasks and the load of every goroutine, shared by the Dispatchers.
+type workerSet struct {
+	ids []int64 // 接收任务的协程
+	// Goroutines taking tasks.
+	pos []int // 协程在ids中的位置，不在时为-1
+	// Position of each goroutine in ids, -1 when absent.
+	load []int // 每个协程的负载
+	// Load of each goroutine.
+	capacity int // 每个协程最多容纳的任务数
+	// Tasks each goroutine can hold.
+}
+
+func (s *workerSet) Init(maxWorkers, capacity int) {
+	s.ids = make([]int64, 0, maxWorkers)
+	s.pos = make([]int, maxWorkers)
+	for i := range s.pos {
+		s.pos[i] = -1
+	}
+	s.load = make([]int, maxWorkers)
+	s.capacity = capacity
+}
+
+func (s *workerSet) Add(n int64) {
+	if s.pos[n] >= 0 {
+		return
+	}
+	s.pos[n] = len(s.ids)
+	s.ids = append(s.ids, n)
+	s.load[n] = 0
+}
+
+func (s *workerSet) Remove(n int64) {
+	i := s.pos[n]
+	if i < 0 {
+		return
+	}
+	last := len(s.ids) - 1
+	s.ids[i] = s.ids[last]
+	s.pos[s.ids[i]] = i
+	s.ids = s.ids[:last]
+	s.pos[n] = -1
+}
+
+func (s *workerSet) Update(n int64, load int) {
+	s.load[n] = load
+}
+
+// free 判断协程n是否还能接收任务
+// free reports whether goroutine n can take another task.
+func (s *workerSet) free(n int64) bool {
+	return s.load[n] < s.capacity
+}
+
+// scan 从ids中的第start个开始依次查找还能接收任务的协程
+// scan looks for a goroutine that can take a task, starting from position start of ids.
+func (s *workerSet) scan(start int) (int64, bool) {
+	for i := 0; i < len(s.ids); i++ {
+		n := s.ids[(start+i)%len(s.ids)]
+		if s.free(n) {
+			return n, true
+		}
+	}
+	return -1, false
+}
+
+// LeastLoadedDispatcher 把任务交给负载最小的协程，使用按负载排序的最小堆
+// LeastLoadedDispatcher hands tasks to the least loaded goroutine, using a min-heap ordered by load.
+type LeastLoadedDispatcher struct {
+	workerSet
+}
+
+// NewLeastLoadedDispatcher 创建LeastLoadedDispatcher，这也是协程池默认的Dispatcher
+// NewLeastLoadedDispatcher creates a LeastLoadedDispatcher, which is also the default Dispatcher of the pool.
+func NewLeastLoadedDispatcher() *LeastLoadedDispatcher {
+	return &LeastLoadedDispatcher{}
+}
+
+// loadHeap 是LeastLoadedDispatcher的堆操作，堆直接使用workerSet的ids，pos记录协程在堆中的位置
+// loadHeap holds the heap operations of LeastLoadedDispatcher, the heap is the ids of the workerSet with pos holding each position.
+type loadHeap LeastLoadedDispatcher
+
+func (h *loadHeap) Len() int { return len(h.ids) }
+
+func (h *loadHeap) Less(i, j int) bool {
+	li, lj := h.load[h.ids[i]], h.load[h.ids[j]]
+	if li != lj {
+		return li < lj
+	}
+	// 负载相同时按编号，结果是确定的
+	// Equal loads are ordered by number, keeping the order deterministic
+	return h.ids[i] < h.ids[j]
+}
+
+func (h *loadHeap) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+	h.pos[h.ids[i]] = i
+	h.pos[h.ids[j]] = j
+}
+
+func (h *loadHeap) Push(x interface{}) {
+	n := x.(int64)
+	h.pos[n] = len(h.ids)
+	h.ids = append(h.ids, n)
+}
+
+func (h *loadHeap) Pop() interface{} {
+	last := len(h.ids) - 1
+	n := h.ids[last]
+	h.ids = h.ids[:last]
+	h.pos[n] = -1
+	return n
+}
+
+func (d *LeastLoadedDispatcher) Add(n int64) {
+	if d.pos[n] >= 0 {
+		return
+	}
+	d.load[n] = 0
+	heap.Push((*loadHeap)(d), n)
+}
+
+func (d *LeastLoadedDispatcher) Remove(n int64) {
+	if i := d.pos[n]; i >= 0 {
+		heap.Remove((*loadHeap)(d), i)
+	}
+}
+
+func (d *LeastLoadedDispatcher) Update(n int64, load int) {
+	d.load[n] = load
+	if i := d.pos[n]; i >= 0 {
+		heap.Fix((*loadHeap)(d), i)
+	}
+}
+
+func (d *LeastLoadedDispatcher) Pick() (int64, bool) {
+	if len(d.ids) == 0 || !d.free(d.ids[0]) {
+		return -1, false
+	}
+	return d.ids[0], true
+}
+
+// RoundRobinDispatcher 依次把任务交给每个协程，跳过已满的协程
+// RoundRobinDispatcher hands tasks to the goroutines in turn, skipping full ones.
+type RoundRobinDispatcher struct {
+	workerSet
+	next int
+}
+
+// NewRoundRobinDispatcher 创建RoundRobinDispatcher
+// NewRoundRobinDispatcher creates a RoundRobinDispatcher.
+func NewRoundRobinDispatcher() *RoundRobinDispatcher {
+	return &RoundRobinDispatcher{}
+}
+
+func (d *RoundRobinDispatcher) Pick() (int64, bool) {
+	if len(d.ids) == 0 {
+		return -1, false
+	}
+	start := d.next % len(d.ids)
+	n, ok := d.scan(start)
+	if ok {
+		d.next = d.pos[n] + 1
+	}
+	return n, ok
+}
+
+// RandomDispatcher 随机选择一个还能接收任务的协程
+// RandomDispatcher picks a random goroutine that can take a task.
+type RandomDispatcher struct {
+	workerSet
+	rand *rand.Rand
+}
+
+// NewRandomDispatcher 创建RandomDispatcher
+// NewRandomDispatcher creates a RandomDispatcher.
+func NewRandomDispatcher() *RandomDispatcher {
+	return &RandomDispatcher{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (d *RandomDispatcher) Pick() (int64, bool) {
+	if len(d.ids) == 0 {
+		return -1, false
+	}
+	// 随机的协程已满时从它开始依次查找
+	// When the random goroutine is full, look on from it
+	return d.scan(d.rand.Intn(len(d.ids)))
+}
+
+// P2CDispatcher 随机选择两个协程，把任务交给其中负载较小的一个（power of two choices），
+// 不需要维护有序的结构，负载也接近LeastLoadedDispatcher
+// P2CDispatcher picks two goroutines at random and hands the task to the less loaded one (power of two choices),
+// it keeps no ordered structure and still balances nearly as well as LeastLoadedDispatcher.
+type P2CDispatcher struct {
+	workerSet
+	rand *rand.Rand
+}
+
+// NewP2CDispatcher 创建P2CDispatcher
+// NewP2CDispatcher creates a P2CDispatcher.
+func NewP2CDispatcher() *P2CDispatcher {
+	return &P2CDispatcher{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (d *P2CDispatcher) Pick() (int64, bool) {
+	c := len(d.ids)
+	if c == 0 {
+		return -1, false
+	}
+	i := d.rand.Intn(c)
+	n := d.ids[i]
+	if c > 1 {
+		j := d.rand.Intn(c - 1)
+		if j >= i {
+			j++
+		}
+		if m := d.ids[j]; d.load[m] < d.load[n] {
+			n, i = m, j
+		}
+	}
+	if d.free(n) {
+		return n, true
+	}
+	return d.scan(i)
+}
+
+// LatencyAwareDispatcher 为每个协程记录执行时间的指数加权移动平均（EWMA），把任务交给预计最早完成的协程。
+// 协程的预计完成时间是(负载+1)*平均执行时间，还没有执行过任务的协程使用其他协程的平均值，
+// 因此有2个慢任务的协程不会比有3个快任务的协程更容易收到新任务。
+// LatencyAwareDispatcher keeps an exponentially weighted moving average (EWMA) of the execution time of each goroutine
+// and hands tasks to the goroutine expected to finish first.
+// The expected finish time of a goroutine is (load+1) times its average, goroutines that have not run a task yet use the average of the others,
+// so a goroutine with 2 slow tasks no longer looks less busy than one with 3 fast tasks.
+type LatencyAwareDispatcher struct {
+	workerSet
+	alpha float64
+	ewma  []float64 // 每个协程的平均执行时间（纳秒），0表示还没有数据
+	// Average execution time of each goroutine in nanoseconds, 0 means no data yet.
+}
+
+// NewLatencyAwareDispatcher 创建LatencyAwareDispatcher，alpha是最新一次执行时间的权重，不在(0,1]之间时使用LatencyAlpha
+// NewLatencyAwareDispatcher creates a LatencyAwareDispatcher, alpha is the weight of the latest run, LatencyAlpha is used when it is outside (0,1].
+func NewLatencyAwareDispatcher(alpha float64) *LatencyAwareDispatcher {
+	if alpha <= 0 || alpha > 1 {
+		alpha = LatencyAlpha
+	}
+	return &LatencyAwareDispatcher{alpha: alpha}
+}
+
+func (d *LatencyAwareDispatcher) Init(maxWorkers, capacity int) {
+	d.workerSet.Init(maxWorkers, capacity)
+	d.ewma = make([]float64, maxWorkers)
+}
+
+func (d *LatencyAwareDispatcher) Add(n int64) {
+	d.workerSet.Add(n)
+	d.ewma[n] = 0
+}
+
+func (d *LatencyAwareDispatcher) RecordExec(n int64, dur time.Duration) {
+	x := float64(dur)
+	if x < 1 {
+		x = 1
+	}
+	if d.ewma[n] == 0 {
+		d.ewma[n] = x
+		return
+	}
+	d.ewma[n] += d.alpha * (x - d.ewma[n])
+}
+
+func (d *LatencyAwareDispatcher) Pick() (int64, bool) {
+	var sum float64
+	var sampled int
+	for _, n := range d.ids {
+		if d.ewma[n] > 0 {
+			sum += d.ewma[n]
+			sampled++
+		}
+	}
+	avg := 1.0
+	if sampled > 0 {
+		avg = sum / float64(sampled)
+	}
+	best, bestCost := int64(-1), 0.0
+	for _, n := range d.ids {
+		if !d.free(n) {
+			continue
+		}
+		est := d.ewma[n]
+		if est == 0 {
+			est = avg
+		}
+		cost := float64(d.load[n]+1) * est
+		if best < 0 || cost < bestCost || (cost == bestCost && d.load[n] < d.load[best]) {
+			best, bestCost = n, cost
+		}
+	}
+	return best, best >= 0
+}
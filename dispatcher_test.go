@@ -0,0 +1,417 @@
+package litepool
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dispatcherCases 是所有的Dispatcher
+// dispatcherCases lists every Dispatcher.
+var dispatcherCases = []struct {
+	name string
+	new  func() Dispatcher
+}{
+	{"LeastLoaded", func() Dispatcher { return NewLeastLoadedDispatcher() }},
+	{"RoundRobin", func() Dispatcher { return NewRoundRobinDispatcher() }},
+	{"P2C", func() Dispatcher { return NewP2CDispatcher() }},
+	{"Random", func() Dispatcher { return NewRandomDispatcher() }},
+	{"LatencyAware", func() Dispatcher { return NewLatencyAwareDispatcher(LatencyAlpha) }},
+}
+
+// spin 忙等d，模拟占用CPU的任务
+// spin busy-waits for d, standing in for a CPU-bound task.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// BenchmarkDispatch 比较各个Dispatcher的吞吐量：每16个任务中有一个慢任务，关闭任务窃取，只看Dispatcher的选择
+// BenchmarkDispatch compares the throughput of the dispatchers: one task in 16 is slow, and work stealing is off so only the Dispatcher's choice counts.
+func BenchmarkDispatch(b *testing.B) {
+	for _, d := range dispatcherCases {
+		b.Run(d.name, func(b *testing.B) {
+			lp := NewPool(8, 16, WithDispatcher(d.new()), WithWorkStealing(false))
+			defer lp.Close()
+			tg := lp.NewTaskGroup(b.N)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cost := time.Microsecond
+				if i%16 == 0 {
+					cost = 50 * time.Microsecond
+				}
+				if err := lp.AddTask(tg.NewTaskOptions().SetAutoDone().SetTask(func() error {
+					spin(cost)
+					return nil
+				})); err != nil {
+					b.Fatal(err)
+				}
+			}
+			tg.Wait()
+			b.StopTimer()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "tasks/s")
+		})
+	}
+}
+
+// loads 按照协程池的方式调用Update记录每个协程的负载
+// loads records the load of every goroutine, calling Update the way the pool does.
+type loads struct {
+	d    Dispatcher
+	load []int
+}
+
+func newLoads(d Dispatcher, maxWorkers, capacity int) *loads {
+	d.Init(maxWorkers, capacity)
+	return &loads{d: d, load: make([]int, maxWorkers)}
+}
+
+func (l *loads) set(n int64, load int) {
+	l.load[n] = load
+	l.d.Update(n, load)
+}
+
+// pick 调用Pick并把选中协程的负载加1
+// pick calls Pick and adds one to the load of the goroutine picked.
+func (l *loads) pick() (int64, bool) {
+	n, ok := l.d.Pick()
+	if ok {
+		l.set(n, l.load[n]+1)
+	}
+	return n, ok
+}
+
+// TestDispatchers 每个Dispatcher只选择接收任务且未满的协程，全满时返回false，Remove之后不再选择，重新Add后负载从0开始
+// TestDispatchers checks that every Dispatcher only picks goroutines that take tasks and are not full, returns false when all are,
+// never picks a removed goroutine and starts a goroutine added again at a load of 0.
+func TestDispatchers(t *testing.T) {
+	for _, dc := range dispatcherCases {
+		t.Run(dc.name, func(t *testing.T) {
+			l := newLoads(dc.new(), 4, 2)
+			if n, ok := l.d.Pick(); ok {
+				t.Fatalf("picked %d with no goroutines", n)
+			}
+			for n := int64(0); n < 3; n++ {
+				l.d.Add(n)
+			}
+			// 3个协程每个容纳2个任务
+			// 3 goroutines holding 2 tasks each
+			for i := 0; i < 6; i++ {
+				n, ok := l.pick()
+				if !ok || n < 0 || n > 2 || l.load[n] > 2 {
+					t.Fatalf("pick %d: goroutine %d %v, loads %v", i, n, ok, l.load)
+				}
+			}
+			if n, ok := l.d.Pick(); ok {
+				t.Fatalf("picked %d with every goroutine full", n)
+			}
+			// 协程1完成一个任务后是唯一的选择
+			// Goroutine 1 is the only choice once it finishes a task
+			l.set(1, 1)
+			if n, ok := l.pick(); !ok || n != 1 {
+				t.Fatalf("picked %d %v, want 1", n, ok)
+			}
+			// 被移除的协程仍然会收到Update，但不会再被选中
+			// A removed goroutine still gets Update but is not picked again
+			l.d.Remove(1)
+			l.set(1, 0)
+			l.set(0, 0)
+			for i := 0; i < 2; i++ {
+				if n, ok := l.pick(); !ok || n != 0 {
+					t.Fatalf("picked %d %v, want 0", n, ok)
+				}
+			}
+			if n, ok := l.d.Pick(); ok {
+				t.Fatalf("picked %d after removing goroutine 1", n)
+			}
+			l.d.Add(3)
+			l.d.Add(1)
+			l.load[1], l.load[3] = 0, 0
+			picked := map[int64]int{}
+			for i := 0; i < 4; i++ {
+				n, ok := l.pick()
+				if !ok || (n != 1 && n != 3) {
+					t.Fatalf("picked %d %v, want 1 or 3", n, ok)
+				}
+				picked[n]++
+			}
+			if picked[1] != 2 || picked[3] != 2 {
+				t.Fatalf("picked %v, want both added goroutines filled", picked)
+			}
+			if n, ok := l.d.Pick(); ok {
+				t.Fatalf("picked %d with every goroutine full", n)
+			}
+		})
+	}
+}
+
+// TestLeastLoadedDispatcher 选择负载最小的协程，负载相同时选择编号最小的
+// TestLeastLoadedDispatcher picks the least loaded goroutine, the lowest number among equal loads.
+func TestLeastLoadedDispatcher(t *testing.T) {
+	tests := []struct {
+		load []int
+		want int64
+	}{
+		{[]int{0, 0, 0, 0}, 0},
+		{[]int{1, 0, 0, 0}, 1},
+		{[]int{3, 2, 1, 2}, 2},
+		{[]int{5, 4, 4, 9}, 1},
+		{[]int{9, 9, 9, 8}, 3},
+	}
+	for _, tt := range tests {
+		l := newLoads(NewLeastLoadedDispatcher(), 4, 10)
+		for n := int64(0); n < 4; n++ {
+			l.d.Add(n)
+		}
+		for n, load := range tt.load {
+			l.set(int64(n), load)
+		}
+		if n, ok := l.d.Pick(); !ok || n != tt.want {
+			t.Fatalf("loads %v: picked %d %v, want %d", tt.load, n, ok, tt.want)
+		}
+	}
+	// 负载一直在变化时堆仍然给出最小值
+	// The heap keeps giving the minimum while loads change
+	l := newLoads(NewLeastLoadedDispatcher(), 8, 100)
+	for n := int64(0); n < 8; n++ {
+		l.d.Add(n)
+	}
+	for i := 0; i < 200; i++ {
+		l.set(int64(i*5%8), i*7%13)
+		n, _ := l.d.Pick()
+		for m, load := range l.load {
+			if load < l.load[n] || (load == l.load[n] && int64(m) < n) {
+				t.Fatalf("step %d: picked %d with load %d, goroutine %d has %d", i, n, l.load[n], m, load)
+			}
+		}
+	}
+}
+
+// TestRoundRobinDispatcher 依次选择协程并跳过已满的协程
+// TestRoundRobinDispatcher picks the goroutines in turn and skips full ones.
+func TestRoundRobinDispatcher(t *testing.T) {
+	l := newLoads(NewRoundRobinDispatcher(), 4, 3)
+	for n := int64(0); n < 4; n++ {
+		l.d.Add(n)
+	}
+	var got []int64
+	for i := 0; i < 6; i++ {
+		n, _ := l.pick()
+		got = append(got, n)
+	}
+	l.set(1, 3)
+	for i := 0; i < 4; i++ {
+		n, _ := l.pick()
+		got = append(got, n)
+	}
+	if want := "[0 1 2 3 0 1 2 3 0 2]"; fmt.Sprint(got) != want {
+		t.Fatalf("picked %v, want %s", got, want)
+	}
+}
+
+// TestP2CDispatcher 从两个随机的协程中选择负载较小的一个，因此负载唯一最大的协程不会被选中
+// TestP2CDispatcher picks the less loaded of two random goroutines, so the one with the highest load is never picked.
+func TestP2CDispatcher(t *testing.T) {
+	l := newLoads(NewP2CDispatcher(), 3, 10)
+	for n := int64(0); n < 3; n++ {
+		l.d.Add(n)
+	}
+	l.set(0, 1)
+	l.set(1, 4)
+	l.set(2, 2)
+	picked := map[int64]int{}
+	for i := 0; i < 300; i++ {
+		n, ok := l.d.Pick()
+		if !ok {
+			t.Fatal("nothing picked")
+		}
+		picked[n]++
+	}
+	// 协程0只在与另外两个一起被选中时胜出，协程2只在与协程1一起时胜出
+	// Goroutine 0 wins whenever it is drawn, goroutine 2 only when drawn with goroutine 1
+	if picked[1] != 0 || picked[0] < picked[2] || picked[2] == 0 {
+		t.Fatalf("picked %v", picked)
+	}
+	// 两个协程时总是选择较小的
+	// With two goroutines the smaller one always wins
+	l.d.Remove(2)
+	for i := 0; i < 50; i++ {
+		if n, _ := l.d.Pick(); n != 0 {
+			t.Fatalf("picked %d, want 0", n)
+		}
+	}
+}
+
+// TestRandomDispatcher 每个未满的协程都会被选中，已满的协程不会
+// TestRandomDispatcher picks every goroutine that is not full and none that is.
+func TestRandomDispatcher(t *testing.T) {
+	l := newLoads(NewRandomDispatcher(), 4, 1)
+	for n := int64(0); n < 4; n++ {
+		l.d.Add(n)
+	}
+	l.set(2, 1)
+	picked := map[int64]int{}
+	for i := 0; i < 300; i++ {
+		n, ok := l.d.Pick()
+		if !ok {
+			t.Fatal("nothing picked")
+		}
+		picked[n]++
+	}
+	if picked[2] != 0 || picked[0] == 0 || picked[1] == 0 || picked[3] == 0 {
+		t.Fatalf("picked %v", picked)
+	}
+}
+
+// TestDispatchersOnPool 每个Dispatcher在协程扩缩时都能执行完所有任务，结束后没有残留的负载
+// TestDispatchersOnPool runs every task with each Dispatcher while the pool scales, leaving no load behind.
+func TestDispatchersOnPool(t *testing.T) {
+	for _, dc := range dispatcherCases {
+		t.Run(dc.name, func(t *testing.T) {
+			lp := NewPool(8, 2, WithDispatcher(dc.new()), WithMinProcess(2))
+			defer lp.Close()
+			const tasks = 400
+			var ran int32
+			tg := lp.NewTaskGroup(tasks)
+			for i := 0; i < tasks; i++ {
+				cost := time.Duration(i%4) * 50 * time.Microsecond
+				if err := lp.AddTask(tg.NewTaskOptions().SetAutoDone().SetTask(func() error {
+					time.Sleep(cost)
+					atomic.AddInt32(&ran, 1)
+					return nil
+				})); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tg.Wait()
+			waitIdle(t, lp)
+			if ran := atomic.LoadInt32(&ran); ran != tasks {
+				t.Fatalf("%d of %d tasks ran", ran, tasks)
+			}
+			s := lp.Stats()
+			for _, w := range s.Workers {
+				if w.QueueDepth != 0 || w.Executing != 0 {
+					t.Fatalf("goroutine %d left with %+v", w.ID, w)
+				}
+			}
+			if s.QueueDepth != 0 || s.Executing != 0 {
+				t.Fatalf("queued %d executing %d", s.QueueDepth, s.Executing)
+			}
+		})
+	}
+}
+
+// TestLatencyAwareRecordExec 第一次执行时间直接作为平均值，之后按照alpha加权，重新Add的协程清空记录
+// TestLatencyAwareRecordExec takes the first execution time as the average and weights later ones by alpha, a goroutine added again starts over.
+func TestLatencyAwareRecordExec(t *testing.T) {
+	for _, alpha := range []float64{0, -1, 1.5} {
+		if d := NewLatencyAwareDispatcher(alpha); d.alpha != LatencyAlpha {
+			t.Fatalf("alpha %v gave %v, want LatencyAlpha", alpha, d.alpha)
+		}
+	}
+	d := NewLatencyAwareDispatcher(0.5)
+	d.Init(2, 1)
+	d.Add(0)
+	ms := float64(time.Millisecond)
+	steps := []struct {
+		d    time.Duration
+		want float64
+	}{
+		{10 * time.Millisecond, 10 * ms},
+		{20 * time.Millisecond, 15 * ms},
+		{20 * time.Millisecond, 17.5 * ms},
+		{5 * time.Millisecond, 11.25 * ms},
+		// 0按1纳秒计算，平均值不会回到表示没有数据的0
+		// 0 counts as 1ns so the average never returns to the 0 meaning no data
+		{0, 5.625*ms + 0.5},
+	}
+	for i, st := range steps {
+		d.RecordExec(0, st.d)
+		if d.ewma[0] != st.want {
+			t.Fatalf("step %d: average %v, want %v", i, d.ewma[0], st.want)
+		}
+	}
+	d.RecordExec(1, 0)
+	if d.ewma[1] != 1 {
+		t.Fatalf("first zero sample gave %v, want 1", d.ewma[1])
+	}
+	d.Remove(0)
+	d.Add(0)
+	if d.ewma[0] != 0 {
+		t.Fatalf("average %v kept after adding the goroutine again", d.ewma[0])
+	}
+	d = NewLatencyAwareDispatcher(1)
+	d.Init(1, 1)
+	d.RecordExec(0, time.Second)
+	d.RecordExec(0, time.Millisecond)
+	if d.ewma[0] != ms {
+		t.Fatalf("alpha 1 keeps %v, want only the latest run", d.ewma[0])
+	}
+}
+
+// TestLatencyAwareDispatcher 选择(负载+1)*平均执行时间最小的协程，没有数据的协程使用其他协程的平均值，相同时选择负载较小的
+// TestLatencyAwareDispatcher picks the goroutine with the smallest (load+1) times average, goroutines without data use the average of the others,
+// and the lower load wins a tie.
+func TestLatencyAwareDispatcher(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		ewma []time.Duration // 0表示没有数据
+		// 0 means no data
+		load []int
+		want int64 // -1表示全满
+		// -1 means every goroutine is full
+	}{
+		{"no data is least loaded", []time.Duration{0, 0, 0}, []int{2, 1, 3}, 1},
+		{"two slow against three fast", []time.Duration{20 * ms, ms}, []int{2, 3}, 1},
+		{"fast but busy", []time.Duration{4 * ms, ms}, []int{0, 4}, 0},
+		// 协程2的平均值按20ms计算：(1+1)*20ms大于协程0的(0+1)*10ms
+		// Goroutine 2 counts as 20ms: (1+1)*20ms is more than (0+1)*10ms of goroutine 0
+		{"no data uses the average", []time.Duration{10 * ms, 30 * ms, 0}, []int{0, 0, 1}, 0},
+		// 协程0和协程2都是20ms，负载较小的协程2胜出
+		// Goroutines 0 and 2 both cost 20ms, goroutine 2 with the lower load wins
+		{"tie goes to the lower load", []time.Duration{10 * ms, 30 * ms, 0}, []int{1, 0, 0}, 2},
+		{"fastest is full", []time.Duration{ms, 10 * ms, 20 * ms}, []int{4, 0, 0}, 1},
+		{"every goroutine full", []time.Duration{ms, 10 * ms}, []int{4, 4}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewLatencyAwareDispatcher(0.5)
+			l := newLoads(d, len(tt.ewma), 4)
+			for n := range tt.ewma {
+				d.Add(int64(n))
+				if tt.ewma[n] > 0 {
+					d.RecordExec(int64(n), tt.ewma[n])
+				}
+				l.set(int64(n), tt.load[n])
+			}
+			n, ok := d.Pick()
+			if ok != (tt.want >= 0) || (ok && n != tt.want) {
+				t.Fatalf("picked %d %v, want %d", n, ok, tt.want)
+			}
+		})
+	}
+}
+
+// TestLatencyAwareOnPool 协程池在每个任务执行后把执行时间交给LatencyAwareDispatcher
+// TestLatencyAwareOnPool has the pool hand the execution time of every task to the LatencyAwareDispatcher.
+func TestLatencyAwareOnPool(t *testing.T) {
+	d := NewLatencyAwareDispatcher(1)
+	lp := NewPool(1, 1, WithDispatcher(d))
+	defer lp.Close()
+	tg := lp.NewTaskGroup(1)
+	lp.AddTask(tg.NewTaskOptions().SetAutoDone().SetTask(func() error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}))
+	tg.Wait()
+	waitIdle(t, lp)
+	lp.mutex.Lock()
+	avg := time.Duration(d.ewma[0])
+	lp.mutex.Unlock()
+	if avg < 5*time.Millisecond || avg > time.Second {
+		t.Fatalf("average %v after a 5ms task", avg)
+	}
+}
@@ -0,0 +1,113 @@
+package litepool
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	// ErrPoolClosed 协程池已关闭或正在关闭，不再接收任务
+	// ErrPoolClosed is returned when the pool is closed or shutting down and no longer accepts tasks.
+	ErrPoolClosed = errors.New("litepool: pool is closed")
+	// ErrNoTask 没有通过SetTask等方法设置任务
+	// ErrNoTask is returned when no task was set with SetTask or its variants.
+	ErrNoTask = errors.New("litepool: no task set")
+	// ErrSubmitTimeout 在SetAddTimeout设置的时间内没有等到空位
+	// ErrSubmitTimeout is returned when no slot became free within the SetAddTimeout duration.
+	ErrSubmitTimeout = errors.New("litepool: submit timed out")
+	// ErrPoolFull 协程池没有空位，由不等待的提交方法返回
+	// ErrPoolFull is returned by non-waiting submissions when the pool has no free slot.
+	ErrPoolFull = errors.New("litepool: pool is full")
+	// ErrExecTimeout 任务执行超过了SetExecTimeout设置的时间
+	// ErrExecTimeout is passed to onError when a task runs longer than the SetExecTimeout duration.
+	ErrExecTimeout = errors.New("litepool: task execution timed out")
+	// ErrTaskCanceled 延迟任务在到期前被取消
+	// ErrTaskCanceled ends a delayed task that was cancelled before it fired.
+	ErrTaskCanceled = errors.New("litepool: task canceled")
+	// ErrInvalidSpec AddRecurring的spec既不是有效的间隔也不是有效的cron表达式
+	// ErrInvalidSpec is returned by AddRecurring when spec is neither a valid interval nor a valid cron expression.
+	ErrInvalidSpec = errors.New("litepool: invalid schedule spec")
+)
+
+// PanicError 是任务panic时的错误，保存recover得到的值和panic时的调用栈，可以用errors.As判断
+// PanicError is the error of a task that panicked, holding the recovered value and the stack at the time of the panic, use errors.As to detect it.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("litepool: task panicked: %v", e.Value)
+}
+
+// Unwrap panic的值是error时返回它
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// asPanicError 将recover得到的值转换为PanicError，已经是PanicError时保留原来的调用栈，需要在defer中调用
+// asPanicError turns a recovered value into a PanicError, keeping the original stack when it already is one, it must be called from a deferred function.
+func asPanicError(r interface{}) *PanicError {
+	if p, ok := r.(*PanicError); ok {
+		return p
+	}
+	return &PanicError{Value: r, Stack: debug.Stack()}
+}
+
+// ErrorClass 是错误的类别，用于选择重试方式，空字符串表示没有分类
+// ErrorClass is the class of an error used to pick a retry policy, the empty string means unclassified.
+type ErrorClass string
+
+const (
+	// ClassRetryable 可以重试的错误，没有为它设置重试方式时按照DefaultRetryPolicy重试
+	// ClassRetryable errors can be retried, DefaultRetryPolicy is used when no policy is set for them.
+	ClassRetryable ErrorClass = "retryable"
+	// ClassPermanent 永久性的错误，任何重试方式和ErrReload都不会重试
+	// ClassPermanent errors are never retried, neither by a retry policy nor by ErrReload.
+	ClassPermanent ErrorClass = "permanent"
+)
+
+// classError 为错误标记类别
+// classError marks an error with a class.
+type classError struct {
+	err   error
+	class ErrorClass
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+
+func (e *classError) Unwrap() error { return e.err }
+
+// Classify 返回标记了类别class的err，errors.Is和errors.As仍然可以找到err，err为nil时返回nil
+// Classify returns err marked with class, errors.Is and errors.As still find err, nil is returned for a nil err.
+func Classify(err error, class ErrorClass) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{err: err, class: class}
+}
+
+// Permanent 将err标记为不可重试的错误
+// Permanent marks err as an error that must not be retried.
+func Permanent(err error) error {
+	return Classify(err, ClassPermanent)
+}
+
+// Retryable 将err标记为可以重试的错误
+// Retryable marks err as an error that can be retried.
+func Retryable(err error) error {
+	return Classify(err, ClassRetryable)
+}
+
+// ClassOf 返回Classify标记在err上的类别，包括被包装的错误和panic的值，没有标记时返回空字符串
+// ClassOf returns the class marked on err with Classify, wrapped errors and panic values included, the empty string when there is none.
+func ClassOf(err error) ErrorClass {
+	var ce *classError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return ""
+}
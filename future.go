@@ -0,0 +1,100 @@
+package litepool
+
+import (
+	"context"
+	"sync"
+)
+
+// Future 保存一个有返回值的任务的结果
+// Future holds the result of a task that returns a value.
+type Future[T any] struct {
+	mutex sync.Mutex
+	done  chan struct{} // 任务结束后关闭
+	// Closed once the task has finished.
+	val      T     // 最近一次成功执行的返回值
+	err      error // 任务最终的错误
+	finished bool
+}
+
+// Submit 将有返回值的任务提交给协程池，提交失败时Future的错误就是AddTask返回的错误
+// Submit hands a task that returns a value to the pool, when AddTask fails its error becomes the error of the Future.
+func Submit[T any](lp *ListPool, f func(ctx context.Context) (T, error)) *Future[T] {
+	return SubmitTask(lp, &TaskOptions{}, f)
+}
+
+// SubmitTask 与Submit相同，但使用给定的TaskOptions，可以配合TaskGroup、SetAutoDone和各种回调使用。
+// 设置的任务会被f替换，Future在onSuccess或onError执行完之后才结束。
+// SubmitTask is like Submit but uses the given TaskOptions, so it works with TaskGroup, SetAutoDone and the callbacks.
+// The task of opt is replaced by f, and the Future finishes after onSuccess or onError has run.
+func SubmitTask[T any](lp *ListPool, opt *TaskOptions, f func(ctx context.Context) (T, error)) *Future[T] {
+	fu := &Future[T]{done: make(chan struct{})}
+	opt.task = func(ctx context.Context) error {
+		v, err := f(ctx)
+		if err == nil {
+			fu.set(v)
+		}
+		return err
+	}
+	opt.setOnEnd(fu.finish)
+	if err := lp.AddTask(opt); err != nil {
+		opt.end(err)
+	}
+	return fu
+}
+
+// set 保存返回值，Future结束后不再修改
+// set stores the value, it is left untouched once the Future has finished.
+func (fu *Future[T]) set(v T) {
+	fu.mutex.Lock()
+	defer fu.mutex.Unlock()
+	if !fu.finished {
+		fu.val = v
+	}
+}
+
+// finish 结束Future，只有第一次调用有效
+// finish completes the Future, only the first call has an effect.
+func (fu *Future[T]) finish(err error) {
+	fu.mutex.Lock()
+	defer fu.mutex.Unlock()
+	if fu.finished {
+		return
+	}
+	fu.finished = true
+	if err != nil {
+		var zero T
+		fu.val = zero
+	}
+	fu.err = err
+	close(fu.done)
+}
+
+// Done 返回任务结束后关闭的通道
+// Done returns a channel that is closed once the task has finished.
+func (fu *Future[T]) Done() <-chan struct{} {
+	return fu.done
+}
+
+// Get 等待任务结束并返回结果，ctx先结束时返回ctx.Err()
+// Get waits for the task to finish and returns its result, or ctx.Err() if ctx is done first.
+func (fu *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-fu.done:
+		return fu.val, fu.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// TryGet 不等待，任务还没有结束时ok为false
+// TryGet does not wait, ok is false while the task has not finished.
+func (fu *Future[T]) TryGet() (val T, ok bool, err error) {
+	select {
+	case <-fu.done:
+		return fu.val, true, fu.err
+	default:
+		var zero T
+		return zero, false, nil
+	}
+}
@@ -0,0 +1,105 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestFutureGet Get返回任务的值或最终的错误，出错时值为零值
+// TestFutureGet returns the value or the final error of the task, the value is zero on error.
+func TestFutureGet(t *testing.T) {
+	lp := NewPool(2, 2)
+	defer lp.Close()
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name    string
+		task    func(ctx context.Context) (int, error)
+		want    int
+		wantErr error
+		panics  bool
+	}{
+		{"value", func(ctx context.Context) (int, error) { return 42, nil }, 42, nil, false},
+		{"error", func(ctx context.Context) (int, error) { return 42, errBoom }, 0, errBoom, false},
+		{"panic", func(ctx context.Context) (int, error) { panic("boom") }, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fu := Submit(lp, tt.task)
+			v, err := fu.Get(context.Background())
+			if v != tt.want {
+				t.Fatalf("value %d, want %d", v, tt.want)
+			}
+			var pe *PanicError
+			if tt.panics {
+				if !errors.As(err, &pe) {
+					t.Fatalf("err %v, want a PanicError", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFutureTryGet TryGet在任务结束之前不等待，结束之后返回结果
+// TestFutureTryGet does not wait before the task has finished and returns the result after.
+func TestFutureTryGet(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	release := make(chan struct{})
+	fu := Submit(lp, func(ctx context.Context) (string, error) {
+		<-release
+		return "done", nil
+	})
+	if v, ok, err := fu.TryGet(); ok || v != "" || err != nil {
+		t.Fatalf("TryGet before the task finished: %q %v %v", v, ok, err)
+	}
+	close(release)
+	<-fu.Done()
+	if v, ok, err := fu.TryGet(); !ok || v != "done" || err != nil {
+		t.Fatalf("TryGet after the task finished: %q %v %v", v, ok, err)
+	}
+}
+
+// TestFutureGetContext ctx先结束时Get返回ctx.Err()，之后仍然可以取得结果
+// TestFutureGetContext returns ctx.Err() from Get when ctx is done first, the result can still be fetched later.
+func TestFutureGetContext(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	release := make(chan struct{})
+	fu := Submit(lp, func(ctx context.Context) (int, error) {
+		<-release
+		return 7, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if v, err := fu.Get(ctx); v != 0 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get with an expired ctx: %d %v", v, err)
+	}
+	close(release)
+	if v, err := fu.Get(context.Background()); v != 7 || err != nil {
+		t.Fatalf("Get after the task finished: %d %v", v, err)
+	}
+}
+
+// TestSubmitTaskCallbacks Future在onError之后才结束，提交失败时Future的错误就是提交的错误
+// TestSubmitTaskCallbacks finishes the Future after onError, and a failed submission becomes the error of the Future.
+func TestSubmitTaskCallbacks(t *testing.T) {
+	lp := NewPool(1, 1)
+	called := false
+	opt := new(TaskOptions).SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { called = true })
+	fu := SubmitTask(lp, opt, func(ctx context.Context) (int, error) { return 0, errors.New("boom") })
+	<-fu.Done()
+	if !called {
+		t.Fatal("Future finished before onError ran")
+	}
+	lp.Close()
+	fu = Submit(lp, func(ctx context.Context) (int, error) { return 1, nil })
+	if _, err := fu.Get(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Submit on a closed pool: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package litepool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// histogramBuckets 是直方图的桶数，第i个桶的上限为1µs<<i，最后一个桶包含更长的时间
+// histogramBuckets is the number of buckets, bucket i ends at 1µs<<i and the last bucket holds everything longer.
+const histogramBuckets = 40
+
+// histogram 是固定内存的耗时直方图，按2的倍数分桶，可以并发记录
+// histogram is a fixed-memory latency histogram with power-of-two buckets, safe for concurrent use.
+type histogram struct {
+	buckets [histogramBuckets]int64
+	sum     int64
+	max     int64
+}
+
+// bucketOf 返回耗时所在的桶
+// bucketOf returns the bucket of a duration.
+func bucketOf(d time.Duration) int {
+	b := 0
+	for limit := time.Microsecond; d > limit && b < histogramBuckets-1; limit <<= 1 {
+		b++
+	}
+	return b
+}
+
+// bucketBounds 返回第i个桶的范围
+// bucketBounds returns the range of bucket i.
+func bucketBounds(i int) (lo, hi time.Duration) {
+	hi = time.Microsecond << uint(i)
+	if i > 0 {
+		lo = hi >> 1
+	}
+	return lo, hi
+}
+
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddInt64(&h.buckets[bucketOf(d)], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+	for {
+		m := atomic.LoadInt64(&h.max)
+		if int64(d) <= m || atomic.CompareAndSwapInt64(&h.max, m, int64(d)) {
+			break
+		}
+	}
+}
+
+// snapshot 返回直方图当前的副本
+// snapshot returns a copy of the histogram.
+func (h *histogram) snapshot() Histogram {
+	var s Histogram
+	for i := range h.buckets {
+		s.Buckets[i] = atomic.LoadInt64(&h.buckets[i])
+		s.Count += s.Buckets[i]
+	}
+	s.Sum = time.Duration(atomic.LoadInt64(&h.sum))
+	s.Max = time.Duration(atomic.LoadInt64(&h.max))
+	return s
+}
+
+// Histogram 是耗时直方图的快照，第i个桶统计(1µs<<(i-1), 1µs<<i]内的次数，第0个桶从0开始，最后一个桶没有上限
+// Histogram is a snapshot of a latency histogram, bucket i counts durations in (1µs<<(i-1), 1µs<<i], bucket 0 starts at 0 and the last one is unbounded.
+type Histogram struct {
+	Buckets [histogramBuckets]int64
+	Count   int64
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+// Mean 返回平均耗时，没有记录时返回0
+// Mean returns the average duration, 0 when nothing was recorded.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Percentile 返回p分位的耗时，p取值为0到100，在桶内按线性插值估算，没有记录时返回0
+// Percentile returns the duration at percentile p, 0 to 100, estimated by linear interpolation within a bucket, 0 when nothing was recorded.
+func (h Histogram) Percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	p = min(max(p, 0), 100)
+	rank := p / 100 * float64(h.Count)
+	var seen int64
+	for i, c := range h.Buckets {
+		if c == 0 || float64(seen+c) < rank {
+			seen += c
+			continue
+		}
+		lo, hi := bucketBounds(i)
+		if i == histogramBuckets-1 || hi > h.Max {
+			hi = h.Max
+		}
+		if lo > hi {
+			lo = hi
+		}
+		frac := (rank - float64(seen)) / float64(c)
+		return lo + time.Duration(frac*float64(hi-lo))
+	}
+	return h.Max
+}
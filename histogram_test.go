@@ -0,0 +1,95 @@
+package litepool
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBucketOf 检查耗时落在哪个桶中，桶的上限包含在桶内
+// TestBucketOf checks which bucket a duration falls in, the upper bound belongs to the bucket.
+func TestBucketOf(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Microsecond, 0},
+		{time.Microsecond + 1, 1},
+		{2 * time.Microsecond, 1},
+		{3 * time.Microsecond, 2},
+		{time.Millisecond, 10},
+		{1024 * time.Microsecond, 10},
+		{1025 * time.Microsecond, 11},
+		{1000 * time.Hour, histogramBuckets - 1},
+	}
+	for _, tt := range tests {
+		if got := bucketOf(tt.d); got != tt.want {
+			t.Errorf("bucketOf(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+// TestHistogramPercentile 检查分位数在桶内的线性插值，以及用最大值限制最后一个有数据的桶
+// TestHistogramPercentile checks the linear interpolation of percentiles within a bucket and the cap of the last used bucket at the maximum.
+func TestHistogramPercentile(t *testing.T) {
+	us := time.Microsecond
+	repeat := func(d time.Duration, n int) []time.Duration {
+		ds := make([]time.Duration, n)
+		for i := range ds {
+			ds[i] = d
+		}
+		return ds
+	}
+	tests := []struct {
+		name     string
+		recorded []time.Duration
+		p        float64
+		want     time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"zero", []time.Duration{0}, 50, 0},
+		{"negative counts as zero", []time.Duration{-time.Second}, 100, 0},
+		{"single p0", []time.Duration{3 * us}, 0, 2 * us},
+		{"single p50", []time.Duration{3 * us}, 50, 2500 * time.Nanosecond},
+		{"single p100", []time.Duration{3 * us}, 100, 3 * us},
+		{"one bucket p25", []time.Duration{5 * us, 6 * us, 7 * us, 8 * us}, 25, 5 * us},
+		{"one bucket p50", []time.Duration{5 * us, 6 * us, 7 * us, 8 * us}, 50, 6 * us},
+		{"one bucket p100", []time.Duration{5 * us, 6 * us, 7 * us, 8 * us}, 100, 8 * us},
+		{"two buckets p50", append(repeat(us, 10), repeat(time.Millisecond, 10)...), 50, us},
+		{"two buckets p75", append(repeat(us, 10), repeat(time.Millisecond, 10)...), 75, 756 * us},
+		{"two buckets p100", append(repeat(us, 10), repeat(time.Millisecond, 10)...), 100, time.Millisecond},
+		{"above 100", []time.Duration{5 * us, 6 * us, 7 * us, 8 * us}, 150, 8 * us},
+		{"below 0", []time.Duration{5 * us, 6 * us, 7 * us, 8 * us}, -5, 4 * us},
+		{"last bucket", []time.Duration{1000 * time.Hour}, 100, 1000 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h histogram
+			for _, d := range tt.recorded {
+				h.record(d)
+			}
+			if got := h.snapshot().Percentile(tt.p); got != tt.want {
+				t.Fatalf("Percentile(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHistogramSnapshot 快照中的次数、总和、最大值和平均值与记录的耗时一致
+// TestHistogramSnapshot has the count, sum, maximum and mean of the recorded durations.
+func TestHistogramSnapshot(t *testing.T) {
+	var h histogram
+	if m := h.snapshot().Mean(); m != 0 {
+		t.Fatalf("mean of an empty histogram %v", m)
+	}
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	s := h.snapshot()
+	if s.Count != 100 || s.Sum != 5050*time.Millisecond || s.Max != 100*time.Millisecond || s.Mean() != 50500*time.Microsecond {
+		t.Fatalf("count %d sum %v max %v mean %v", s.Count, s.Sum, s.Max, s.Mean())
+	}
+	if p50, p99 := s.Percentile(50), s.Percentile(99); p50 < 32*time.Millisecond || p50 > 66*time.Millisecond || p99 < 66*time.Millisecond || p99 > 100*time.Millisecond {
+		t.Fatalf("p50 %v p99 %v outside their buckets", p50, p99)
+	}
+}
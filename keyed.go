@@ -0,0 +1,177 @@
+package litepool
+
+import "context"
+
+// keyState 记录一个键的租约：holder是正在排队、执行或等待重试的任务，waiting是按提交顺序排在它后面的任务。
+// waiting中的任务计入pending，但不占用空位也不属于任何协程，轮到它时接过holder的空位，因此一个键最多占用一个空位。
+// keyState is the lease of a key: holder is the task that is queued, running or waiting for a retry, and waiting holds the tasks behind it in submission order.
+// Tasks in waiting count towards pending but hold no slot and belong to no goroutine, each takes over the holder's slot when its turn comes, so a key holds one slot at most.
+type keyState struct {
+	holder  *TaskOptions
+	waiting []*TaskOptions
+}
+
+// SetKey 设置任务的键，键相同的任务按提交的顺序一个接一个执行，包括重试在内前一个任务最终结束后下一个任务才开始，
+// 不同的键仍然分散到各个协程并行执行。空字符串表示没有键。SetExecTimeout超时的任务返回之前不会交出键，但协程不再等待它
+// SetKey sets the key of the task, tasks with the same key run one at a time in submission order, the next one starting only after
+// the previous one has finished for good, retries included, while different keys still spread across the goroutines. The empty string means no key.
+// A task that hit its SetExecTimeout keeps the key until it returns, though the goroutine no longer waits for it.
+func (t *TaskOptions) SetKey(key string) *TaskOptions {
+	t.key = key
+	return t
+}
+
+// waitKey 在任务的键已经被占用时把任务排到键的等待队列中，返回true表示已经排入，调用时需持有lp.mutex。
+// 占用键的任务重试时保留着空位，由redispatch直接交给协程，不经过这里，所以同一个任务再次提交时同样要排队
+// waitKey queues the task behind the holder of its key when the key is taken, true means it was queued, lp.mutex must be held.
+// A holder being retried keeps its slot and goes straight to a goroutine through redispatch, never through here, so the same task submitted again waits as well.
+func (lp *ListPool) waitKey(f *TaskOptions) bool {
+	if f.key == "" {
+		return false
+	}
+	ks := lp.keys[f.key]
+	if ks == nil {
+		return false
+	}
+	ks.waiting = append(ks.waiting, f)
+	lp.keyWaiting++
+	return true
+}
+
+// holdKey 让任务占用它的键，调用时需持有lp.mutex
+// holdKey makes the task the holder of its key, lp.mutex must be held.
+func (lp *ListPool) holdKey(f *TaskOptions) {
+	if f.key == "" {
+		return
+	}
+	if lp.keys == nil {
+		lp.keys = map[string]*keyState{}
+	}
+	ks := lp.keys[f.key]
+	if ks == nil {
+		ks = &keyState{}
+		lp.keys[f.key] = ks
+	}
+	ks.holder = f
+}
+
+// releaseKey 在任务最终结束或被放弃后减少pending，并把它的键连同空位交给下一个任务，没有下一个任务时归还空位。
+// n>=0时交给协程n，否则交给Dispatcher选择的协程，协程n刚刚归还了这个任务的位置，因此不会超过它的容量。调用时需持有lp.mutex
+// releaseKey decrements pending for a task that finished for good or was abandoned and passes its key together with its slot on to the next task,
+// the slot is given back when there is no next task. The next task goes to goroutine n when n>=0 and to the goroutine the Dispatcher picks otherwise,
+// goroutine n has just given back the room of the finished task so its capacity is not exceeded. lp.mutex must be held.
+func (lp *ListPool) releaseKey(n int64, f *TaskOptions) {
+	if f.inflight != nil {
+		// 执行超时的任务还没有返回，返回后再交出键和空位，协程不用等待
+		// The task that timed out has not returned yet, the key and the slot are passed on once it does, without the goroutine waiting
+		lp.afterReturn(f, func() { lp.releaseKey(-1, f) })
+		return
+	}
+	if lp.passKey(n, f) {
+		lp.unpend()
+		return
+	}
+	lp.settle()
+}
+
+// passKey 把f占用的键交给下一个等待的任务，返回false表示f没有占用键或者没有下一个任务，调用时需持有lp.mutex
+// passKey hands the key held by f to the next waiting task, false means f holds no key or no task is waiting, lp.mutex must be held.
+func (lp *ListPool) passKey(n int64, f *TaskOptions) bool {
+	if f.key == "" {
+		return false
+	}
+	ks := lp.keys[f.key]
+	if ks == nil || ks.holder != f {
+		return false
+	}
+	for len(ks.waiting) > 0 {
+		next := ks.waiting[0]
+		ks.waiting[0] = nil
+		ks.waiting = ks.waiting[1:]
+		lp.keyWaiting--
+		w, ok := n, n >= 0
+		if !ok && !lp.abort {
+			w, ok = lp.place()
+		}
+		if !ok {
+			// 正在放弃任务，或者已经没有可以接收任务的协程
+			// Tasks are being abandoned, or no goroutine can take the task any more
+			lp.abandonWaiting(next)
+			continue
+		}
+		ks.holder = next
+		lp.enqueue(w, next)
+		return true
+	}
+	delete(lp.keys, f.key)
+	return false
+}
+
+// abandonWaiting 放弃一个等待键的任务，它没有占用空位，调用时需持有lp.mutex
+// abandonWaiting drops a task waiting for its key, which holds no slot, lp.mutex must be held.
+func (lp *ListPool) abandonWaiting(f *TaskOptions) {
+	lp.abandoned = append(lp.abandoned, f)
+	f.end(ErrPoolClosed)
+	lp.unpend()
+}
+
+// redispatch 将保留着空位等待重试的任务交给协程，调用时需持有lp.mutex
+// redispatch hands a task that kept its slot while waiting for a retry to a goroutine, lp.mutex must be held.
+func (lp *ListPool) redispatch(f *TaskOptions) {
+	if f.inflight != nil {
+		// 上一次执行超时后还没有返回，返回后再重试
+		// The previous run timed out and has not returned yet, retry once it does
+		lp.afterReturn(f, func() { lp.redispatch(f) })
+		return
+	}
+	lp.begin(context.Background(), f)
+	n, ok := lp.place()
+	if !ok {
+		lp.firing.Add(1)
+		go func() {
+			defer lp.firing.Done()
+			lp.dropRetry(f, true, ErrPoolClosed)
+		}()
+		return
+	}
+	lp.enqueue(n, f)
+}
+
+// afterReturn 在执行超时的任务返回后持有lp.mutex调用next，调用时需持有lp.mutex
+// afterReturn calls next with lp.mutex held once the task that timed out has returned, lp.mutex must be held.
+func (lp *ListPool) afterReturn(f *TaskOptions, next func()) {
+	inflight := f.inflight
+	f.inflight = nil
+	go func() {
+		<-inflight
+		lp.mutex.Lock()
+		defer lp.mutex.Unlock()
+		next()
+	}()
+}
+
+// place 与pick相同，但所有协程都已满时仍然交给一个接收任务的协程，用于已经占用空位的任务，调用时需持有lp.mutex
+// place is like pick but falls back to any goroutine taking tasks when all of them are full, for tasks that already hold a slot, lp.mutex must be held.
+func (lp *ListPool) place() (int64, bool) {
+	if n, ok := lp.pick(); ok {
+		return n, true
+	}
+	for n, accepting := range lp.accepting {
+		if accepting {
+			return int64(n), true
+		}
+	}
+	return -1, false
+}
+
+// abandonKeyed 放弃所有等待键的任务，占用键的任务结束后不再有后续任务，调用时需持有lp.mutex
+// abandonKeyed drops every task waiting for its key, so holders have no successor when they finish, lp.mutex must be held.
+func (lp *ListPool) abandonKeyed() {
+	for _, ks := range lp.keys {
+		for _, f := range ks.waiting {
+			lp.keyWaiting--
+			lp.abandonWaiting(f)
+		}
+		ks.waiting = nil
+	}
+}
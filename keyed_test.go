@@ -0,0 +1,343 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyRecorder 记录每个键的任务完成的顺序，并检查同一个键的任务没有同时执行
+// keyRecorder records the order in which the tasks of each key finish and checks that no two tasks of a key overlap.
+type keyRecorder struct {
+	t       *testing.T
+	mutex   sync.Mutex
+	running map[string]int
+	order   map[string][]int
+}
+
+func newKeyRecorder(t *testing.T) *keyRecorder {
+	return &keyRecorder{t: t, running: map[string]int{}, order: map[string][]int{}}
+}
+
+// run 执行键为key的第i个任务，耗时随机
+// run runs task i of key, taking a random time.
+func (r *keyRecorder) run(key string, i int) {
+	r.mutex.Lock()
+	r.running[key]++
+	if r.running[key] > 1 {
+		r.t.Errorf("two tasks of key %s run at once", key)
+	}
+	r.mutex.Unlock()
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	r.mutex.Lock()
+	r.running[key]--
+	r.order[key] = append(r.order[key], i)
+	r.mutex.Unlock()
+}
+
+// check 检查每个键的n个任务都按照提交顺序完成
+// check verifies that the n tasks of every key finished in submission order.
+func (r *keyRecorder) check(keys []string, n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, key := range keys {
+		got := r.order[key]
+		if len(got) != n {
+			r.t.Fatalf("key %s finished %d of %d tasks", key, len(got), n)
+		}
+		for i, v := range got {
+			if v != i {
+				r.t.Fatalf("key %s finished out of order: %v", key, got)
+			}
+		}
+	}
+}
+
+// TestKeyedOrderWithStealing 同一个键的任务按提交顺序依次执行，任务窃取和优先级不会打乱顺序
+// TestKeyedOrderWithStealing runs the tasks of a key one at a time in submission order, work stealing and priorities do not reorder them.
+func TestKeyedOrderWithStealing(t *testing.T) {
+	lp := NewPool(4, 3, WithWorkStealing(true))
+	defer lp.Close()
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	const n = 50
+	r := newKeyRecorder(t)
+	tg := lp.NewTaskGroup(len(keys) * n)
+	for i := 0; i < n; i++ {
+		for _, key := range keys {
+			i, key := i, key
+			// 混入没有键的慢任务，让协程的队列变长，触发任务窃取
+			// Mix in slow unkeyed tasks so that queues grow and goroutines steal
+			if i%10 == 0 {
+				lp.AddTask(new(TaskOptions).SetTask(func() error { time.Sleep(time.Millisecond); return nil }))
+			}
+			if err := lp.AddTask(tg.NewTaskOptions().SetKey(key).SetAutoDone().SetPriority(rand.Intn(5)).SetTask(func() error {
+				r.run(key, i)
+				return nil
+			})); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tg.Wait()
+	r.check(keys, n)
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if len(lp.keys) != 0 || lp.keyWaiting != 0 {
+		t.Fatalf("%d keys held and %d tasks waiting after all tasks finished", len(lp.keys), lp.keyWaiting)
+	}
+}
+
+// TestKeyedOrderWithRetries 重试最终结束之前同一个键的下一个任务不会开始
+// TestKeyedOrderWithRetries does not start the next task of a key before the retries of the previous one are over.
+func TestKeyedOrderWithRetries(t *testing.T) {
+	lp := NewPool(4, 2)
+	defer lp.Close()
+	keys := []string{"a", "b", "c"}
+	const n = 20
+	r := newKeyRecorder(t)
+	tg := lp.NewTaskGroup(len(keys) * n)
+	policy := RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}
+	for i := 0; i < n; i++ {
+		for _, key := range keys {
+			i, key := i, key
+			var tries int32
+			if err := lp.AddTask(tg.NewTaskOptions().SetKey(key).SetAutoDone().SetRetryPolicy(policy).SetTask(func() error {
+				// 每三个任务中有一个前两次执行失败
+				// One task in three fails its first two runs
+				if i%3 == 0 && atomic.AddInt32(&tries, 1) < 3 {
+					return errors.New("try again")
+				}
+				r.run(key, i)
+				return nil
+			})); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tg.Wait()
+	r.check(keys, n)
+}
+
+// TestKeyedRetryDoesNotStarve 只有一个协程和两个空位时，等待重试的任务不会被排在它后面的同键任务占满空位而卡住
+// TestKeyedRetryDoesNotStarve keeps a retry from getting stuck behind same-key tasks filling every slot of a one-goroutine, two-slot pool.
+func TestKeyedRetryDoesNotStarve(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	r := newKeyRecorder(t)
+	tg := lp.NewTaskGroup(6)
+	var tries int32
+	lp.AddTask(tg.NewTaskOptions().SetKey("k").SetAutoDone().
+		SetRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: 2 * time.Millisecond}).
+		SetTask(func() error {
+			if atomic.AddInt32(&tries, 1) < 3 {
+				return errors.New("try again")
+			}
+			r.run("k", 0)
+			return nil
+		}))
+	go func() {
+		for i := 1; i < 6; i++ {
+			i := i
+			lp.AddTask(tg.NewTaskOptions().SetKey("k").SetAutoDone().SetTask(func() error {
+				r.run("k", i)
+				return nil
+			}))
+		}
+	}()
+	done := make(chan struct{})
+	go func() { tg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("keyed retry starved")
+	}
+	r.check([]string{"k"}, 6)
+}
+
+// TestKeyedSlots 等待键的任务不占用空位，一个键的大量任务不会让其他键的任务等待空位
+// TestKeyedSlots keeps tasks waiting for their key from holding slots, so a burst of tasks on one key does not make other keys wait for a slot.
+func TestKeyedSlots(t *testing.T) {
+	lp := NewPool(4, 1)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	r := newKeyRecorder(t)
+	tg := lp.NewTaskGroup(20)
+	for i := 0; i < 20; i++ {
+		i := i
+		// 空位只有8个，等待的任务占用空位时提交会超时
+		// There are only 8 slots, submissions time out when waiting tasks hold them
+		if err := lp.AddTask(tg.NewTaskOptions().SetKey("a").SetAutoDone().SetAddTimeout(time.Second).SetTask(func() error {
+			if i == 0 {
+				close(started)
+				<-block
+			}
+			r.run("a", i)
+			return nil
+		})); err != nil {
+			t.Fatalf("task %d of key a: %v", i, err)
+		}
+	}
+	<-started
+	start := time.Now()
+	if _, err := SubmitTask(lp, new(TaskOptions).SetKey("b").SetAddTimeout(time.Second), func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, nil
+	}).Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > 50*time.Millisecond {
+		t.Fatalf("task of key b took %v", waited)
+	}
+	// 只有占用键a的任务持有空位
+	// Only the holder of key a holds a slot
+	deadline := time.Now().Add(time.Second)
+	for s := lp.Stats(); s.IdleSlots != 7 || s.KeyWaiting != 19; s = lp.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d idle slots and %d tasks waiting, want 7 and 19", s.IdleSlots, s.KeyWaiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if p := lp.Pending(); p != 20 {
+		t.Fatalf("%d tasks pending, want 20", p)
+	}
+	close(block)
+	tg.Wait()
+	r.check([]string{"a"}, 20)
+	lp.Close()
+	if s := lp.Stats(); s.IdleSlots != 8 {
+		t.Fatalf("%d idle slots after closing, want all 8 back", s.IdleSlots)
+	}
+}
+
+// TestKeyedSameOptions 同一个有键的TaskOptions提交多次时同样一次只执行一个
+// TestKeyedSameOptions runs one submission at a time when the same keyed TaskOptions is submitted several times.
+func TestKeyedSameOptions(t *testing.T) {
+	lp := NewPool(4, 4)
+	defer lp.Close()
+	var running, overlap, runs int32
+	done := make(chan struct{})
+	opt := new(TaskOptions).SetKey("k").SetTask(func() error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlap, 1)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if atomic.AddInt32(&runs, 1) == 8 {
+			close(done)
+		}
+		return nil
+	})
+	for i := 0; i < 8; i++ {
+		if err := lp.AddTask(opt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if overlap != 0 {
+		t.Fatal("submissions of the same keyed task overlapped")
+	}
+}
+
+// TestKeyedExecTimeout 执行超时后协程继续执行其他任务，同一个键的下一个任务和重试等到超时的任务返回才开始
+// TestKeyedExecTimeout moves the goroutine on after an exec timeout, while the next task of the key and the retries wait until the task that timed out has returned.
+func TestKeyedExecTimeout(t *testing.T) {
+	lp := NewPool(1, 4)
+	defer lp.Close()
+	var running, overlap, runs int32
+	tg := lp.NewTaskGroup(3)
+	for i := 0; i < 3; i++ {
+		lp.AddTask(tg.NewTaskOptions().SetKey("k").SetExecTimeout(5 * time.Millisecond).
+			SetRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}).
+			SetTaskContext(func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				if atomic.AddInt32(&running, 1) > 1 {
+					atomic.StoreInt32(&overlap, 1)
+				}
+				<-ctx.Done()
+				// 取消后还要过一会才返回
+				// Take a while to return after the cancellation
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return ctx.Err()
+			}).
+			SetOnError(func(h *ErrHandle, g *TaskGroup, err error) {
+				if !errors.Is(err, ErrExecTimeout) {
+					t.Error(err)
+				}
+				g.Done()
+			}))
+	}
+	// 唯一的协程不等超时的任务返回，先执行了这个任务
+	// The only goroutine runs this task without waiting for the task that timed out to return
+	other := make(chan int32, 1)
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		other <- atomic.LoadInt32(&running)
+		return nil
+	}))
+	if r := <-other; r != 1 {
+		t.Fatalf("%d keyed tasks running, want the goroutine to move on while the first one is still running", r)
+	}
+	tg.Wait()
+	if overlap != 0 {
+		t.Fatal("a run of the key started while the one that timed out was still running")
+	}
+	if runs != 6 {
+		t.Fatalf("%d runs, want 2 for each of the 3 tasks", runs)
+	}
+	waitIdle(t, lp)
+	if s := lp.Stats(); s.IdleSlots != 5 || s.KeyWaiting != 0 {
+		t.Fatalf("%d idle slots and %d tasks waiting, want 5 and 0", s.IdleSlots, s.KeyWaiting)
+	}
+}
+
+// TestKeyedShutdown 放弃时返回等待键的任务，执行完时按顺序执行它们
+// TestKeyedShutdown returns the tasks waiting for their key when aborting and runs them in order when draining.
+func TestKeyedShutdown(t *testing.T) {
+	for _, mode := range []ShutdownMode{ShutdownAbort, ShutdownDrain} {
+		t.Run(mode.String(), func(t *testing.T) {
+			lp := NewPool(2, 10)
+			r := newKeyRecorder(t)
+			block := make(chan struct{})
+			started := make(chan struct{})
+			lp.AddTask(new(TaskOptions).SetKey("k").SetTask(func() error {
+				close(started)
+				<-block
+				r.run("k", 0)
+				return nil
+			}))
+			<-started
+			for i := 1; i < 6; i++ {
+				i := i
+				lp.AddTask(new(TaskOptions).SetKey("k").SetTask(func() error {
+					r.run("k", i)
+					return nil
+				}))
+			}
+			if s := lp.Stats(); s.KeyWaiting != 5 {
+				t.Fatalf("KeyWaiting %d, want 5", s.KeyWaiting)
+			}
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				close(block)
+			}()
+			abandoned, err := lp.Shutdown(context.Background(), mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if mode == ShutdownAbort {
+				want = 5
+			}
+			if len(abandoned) != want {
+				t.Fatalf("abandoned %d, want %d", len(abandoned), want)
+			}
+			r.check([]string{"k"}, 6-want)
+			if s := lp.Stats(); s.KeyWaiting != 0 {
+				t.Fatalf("KeyWaiting %d after shutdown", s.KeyWaiting)
+			}
+		})
+	}
+}
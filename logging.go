@@ -0,0 +1,48 @@
+package litepool
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger 设置协程池的日志，panic、缩放、提交超时和关闭时放弃的任务等诊断信息都通过它输出，默认不输出
+// WithLogger sets the logger of the pool, diagnostics such as panics, scaling, submit timeouts and tasks dropped on close go through it, nothing is logged by default.
+func WithLogger(l *slog.Logger) PoolOption {
+	return func(lp *ListPool) {
+		if l != nil {
+			lp.logger = l
+		}
+	}
+}
+
+// log 输出一条与任务有关的日志，n<0表示没有协程
+// log writes a record about a task, n<0 means no goroutine is involved.
+func (lp *ListPool) log(level slog.Level, msg string, n int64, f *TaskOptions, attrs ...slog.Attr) {
+	ctx := context.Background()
+	if !lp.logger.Enabled(ctx, level) {
+		return
+	}
+	base := make([]slog.Attr, 0, 4+len(attrs))
+	if n >= 0 {
+		base = append(base, slog.Int64("worker", n))
+	}
+	if f != nil {
+		base = append(base, slog.Uint64("task", f.id))
+		if f.name != "" {
+			base = append(base, slog.String("name", f.name))
+		}
+		if f.tg != nil {
+			base = append(base, slog.Uint64("group", f.tg.id))
+		}
+	}
+	lp.logger.LogAttrs(ctx, level, msg, append(base, attrs...)...)
+}
+
+// discardHandler 丢弃所有记录，没有设置WithLogger时使用，slog.DiscardHandler需要Go 1.24
+// discardHandler drops every record, it is used without WithLogger since slog.DiscardHandler needs Go 1.24.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
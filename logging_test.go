@@ -0,0 +1,59 @@
+package litepool
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer 是可以并发写入的bytes.Buffer
+// lockedBuffer is a bytes.Buffer that can be written concurrently.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// TestDefaultLogger 没有设置WithLogger时不输出任何级别的日志
+// TestDefaultLogger logs nothing at any level without WithLogger.
+func TestDefaultLogger(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+		if lp.logger.Enabled(context.Background(), level) {
+			t.Fatalf("default logger enabled at %v", level)
+		}
+	}
+}
+
+// TestWithLogger 任务的日志带有worker、task和group属性
+// TestWithLogger writes task records with the worker, task and group attributes.
+func TestWithLogger(t *testing.T) {
+	var buf lockedBuffer
+	lp := NewPool(1, 1, WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	tg := lp.NewTaskGroup(1)
+	lp.AddTask(tg.NewTaskOptions().SetName("report").SetTask(func() error { panic("boom") }).
+		SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { g.Done() }))
+	tg.Wait()
+	lp.Close()
+	out := buf.String()
+	for _, want := range []string{`msg="task panicked" worker=0 task=1 name=report group=1`, "panic=boom", `msg="pool closed"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("%q not logged:\n%s", want, out)
+		}
+	}
+}
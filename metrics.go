@@ -0,0 +1,167 @@
+package litepool
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metricsContentType 是OpenMetrics文本格式的Content-Type
+// metricsContentType is the Content-Type of the OpenMetrics text format.
+const metricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsHandler 返回以OpenMetrics文本格式输出协程池指标的http.Handler，Prometheus可以直接抓取。
+// 每个协程池的指标带有pool标签，值为WithName设置的名称，没有设置时为"default"，同一进程中的多个协程池需要使用不同的名称。
+// MetricsHandler returns an http.Handler that writes the metrics of the pools in the OpenMetrics text format, ready for Prometheus to scrape.
+// Every metric carries a pool label set to the WithName name, "default" when unset, so several pools in one process need distinct names.
+func MetricsHandler(pools ...*ListPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		_ = WriteMetrics(w, pools...)
+	})
+}
+
+// WriteMetrics 将协程池的指标以OpenMetrics文本格式写入w
+// WriteMetrics writes the metrics of the pools to w in the OpenMetrics text format.
+func WriteMetrics(w io.Writer, pools ...*ListPool) error {
+	stats := make([]Stats, len(pools))
+	for i, lp := range pools {
+		stats[i] = lp.Stats()
+	}
+	return writeMetrics(w, stats)
+}
+
+// writeMetrics 将协程池的运行信息以OpenMetrics文本格式写入w
+// writeMetrics writes the snapshots of the pools to w in the OpenMetrics text format.
+func writeMetrics(w io.Writer, stats []Stats) error {
+	mw := &metricsWriter{w: bufio.NewWriter(w)}
+
+	gauges := []struct {
+		name, help string
+		value      func(s *Stats) int
+	}{
+		{"litepool_workers", "Goroutines currently running.", func(s *Stats) int { return s.RunningWorkers }},
+		{"litepool_workers_max", "Maximum number of goroutines.", func(s *Stats) int { return s.MaxWorkers }},
+		{"litepool_workers_min", "Minimum number of goroutines kept when auto-scaling.", func(s *Stats) int { return s.MinWorkers }},
+		{"litepool_workers_idle", "Running goroutines with no queued or executing task.", func(s *Stats) int { return s.IdleWorkers }},
+		{"litepool_idle_slots", "Slots that can take a task right away.", func(s *Stats) int { return s.IdleSlots }},
+		{"litepool_tasks_queued", "Tasks waiting in the goroutine queues.", func(s *Stats) int { return s.QueueDepth }},
+		{"litepool_tasks_executing", "Tasks being executed.", func(s *Stats) int { return s.Executing }},
+		{"litepool_tasks_delayed", "Delayed tasks that have not fired yet.", func(s *Stats) int { return s.Delayed }},
+	}
+	for _, g := range gauges {
+		mw.family(g.name, "gauge", g.help)
+		for i := range stats {
+			mw.sample(g.name, poolLabel(&stats[i]), strconv.Itoa(g.value(&stats[i])))
+		}
+	}
+
+	mw.family("litepool_worker_queue_length", "gauge", "Tasks waiting in the queue of each goroutine.")
+	for i := range stats {
+		for _, ws := range stats[i].Workers {
+			labels := poolLabel(&stats[i]) + `,worker="` + strconv.FormatInt(ws.ID, 10) + `"`
+			mw.sample("litepool_worker_queue_length", labels, strconv.Itoa(ws.QueueDepth))
+		}
+	}
+
+	counters := []struct {
+		name, help string
+		value      func(s *Stats) int64
+	}{
+		{"litepool_tasks_executed", "Tasks executed.", func(s *Stats) int64 { return s.Executed }},
+		{"litepool_tasks_succeeded", "Tasks that finished without an error.", func(s *Stats) int64 { return s.Successes }},
+		{"litepool_tasks_failed", "Tasks that returned an error.", func(s *Stats) int64 { return s.Failures }},
+		{"litepool_tasks_panicked", "Tasks that panicked.", func(s *Stats) int64 { return s.Panics }},
+		{"litepool_tasks_stolen", "Tasks idle goroutines took from the queues of busy ones.", func(s *Stats) int64 { return s.Stolen }},
+		{"litepool_submit_timeouts", "Submissions that did not get a slot in time.", func(s *Stats) int64 { return s.SubmitTimeouts }},
+	}
+	for _, c := range counters {
+		mw.family(c.name, "counter", c.help)
+		for i := range stats {
+			mw.sample(c.name+"_total", poolLabel(&stats[i]), strconv.FormatInt(c.value(&stats[i]), 10))
+		}
+	}
+
+	mw.family("litepool_busy_seconds", "counter", "Total time spent executing tasks.")
+	for i := range stats {
+		mw.sample("litepool_busy_seconds_total", poolLabel(&stats[i]), formatSeconds(int64(stats[i].BusyTime)))
+	}
+
+	mw.family("litepool_queue_wait_seconds", "histogram", "Time from submission to the start of execution.")
+	for i := range stats {
+		mw.histogram("litepool_queue_wait_seconds", poolLabel(&stats[i]), &stats[i].QueueWait)
+	}
+	mw.family("litepool_exec_seconds", "histogram", "Execution time of tasks.")
+	for i := range stats {
+		mw.histogram("litepool_exec_seconds", poolLabel(&stats[i]), &stats[i].ExecTime)
+	}
+
+	mw.line("# EOF")
+	return mw.flush()
+}
+
+// metricsWriter 输出OpenMetrics文本，记录第一个写入错误
+// metricsWriter writes OpenMetrics text and keeps the first write error.
+type metricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (mw *metricsWriter) line(s string) {
+	if mw.err == nil {
+		_, mw.err = mw.w.WriteString(s + "\n")
+	}
+}
+
+func (mw *metricsWriter) family(name, typ, help string) {
+	mw.line("# TYPE " + name + " " + typ)
+	mw.line("# HELP " + name + " " + help)
+}
+
+func (mw *metricsWriter) sample(name, labels, value string) {
+	mw.line(name + "{" + labels + "} " + value)
+}
+
+// histogram 输出累计的桶、_sum和_count，最后一个桶为+Inf
+// histogram writes the cumulative buckets, _sum and _count, the last bucket being +Inf.
+func (mw *metricsWriter) histogram(name, labels string, h *Histogram) {
+	var cum int64
+	for i, c := range h.Buckets {
+		cum += c
+		le := "+Inf"
+		if i < histogramBuckets-1 {
+			_, hi := bucketBounds(i)
+			le = formatSeconds(int64(hi))
+		}
+		mw.sample(name+"_bucket", labels+`,le="`+le+`"`, strconv.FormatInt(cum, 10))
+	}
+	mw.sample(name+"_sum", labels, formatSeconds(int64(h.Sum)))
+	mw.sample(name+"_count", labels, strconv.FormatInt(h.Count, 10))
+}
+
+func (mw *metricsWriter) flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
+	return mw.w.Flush()
+}
+
+// poolLabel 返回pool标签，名称中的反斜杠、引号和换行会被转义
+// poolLabel returns the pool label, escaping backslashes, quotes and newlines in the name.
+func poolLabel(s *Stats) string {
+	name := s.Name
+	if name == "" {
+		name = "default"
+	}
+	return `pool="` + labelEscaper.Replace(name) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatSeconds 将纳秒转换为秒
+// formatSeconds converts nanoseconds to seconds.
+func formatSeconds(ns int64) string {
+	return strconv.FormatFloat(float64(ns)/1e9, 'g', -1, 64)
+}
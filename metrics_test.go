@@ -0,0 +1,178 @@
+package litepool
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bucketLines 返回一个直方图的所有_bucket行，cum(i)是到第i个桶为止的累计次数
+// bucketLines returns every _bucket line of a histogram, cum(i) being the cumulative count up to bucket i.
+func bucketLines(name, labels string, cum func(i int) int64) string {
+	var b strings.Builder
+	for i := 0; i < histogramBuckets; i++ {
+		le := "+Inf"
+		if i < histogramBuckets-1 {
+			le = strconv.FormatFloat(float64(int64(1)<<i)/1e6, 'g', -1, 64)
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, cum(i))
+	}
+	return b.String()
+}
+
+// TestWriteMetrics 检查两个协程池的完整OpenMetrics输出，包括标签转义和累计的直方图桶
+// TestWriteMetrics checks the complete OpenMetrics output of two pools, label escaping and cumulative histogram buckets included.
+func TestWriteMetrics(t *testing.T) {
+	var queueWait, execTime histogram
+	queueWait.record(0)
+	queueWait.record(3 * time.Microsecond)
+	execTime.record(1500 * time.Microsecond)
+	execTime.record(2 * time.Second)
+	stats := []Stats{
+		{
+			Name: `batch "a"`, MaxWorkers: 2, MinWorkers: 1, RunningWorkers: 1, IdleSlots: 1, QueueDepth: 1, Executing: 1, Delayed: 3,
+			Workers:  []WorkerStats{{ID: 0, QueueDepth: 1}, {ID: 1}},
+			Executed: 5, Successes: 3, Failures: 1, Panics: 1, Stolen: 2, SubmitTimeouts: 4, BusyTime: 1500 * time.Millisecond,
+			QueueWait: queueWait.snapshot(), ExecTime: execTime.snapshot(),
+		},
+		{MaxWorkers: 1, MinWorkers: 1, RunningWorkers: 1, IdleWorkers: 1, IdleSlots: 2, Workers: []WorkerStats{{ID: 0}}},
+	}
+	a, def := `pool="batch \"a\""`, `pool="default"`
+	none := func(int) int64 { return 0 }
+	want := `# TYPE litepool_workers gauge
+# HELP litepool_workers Goroutines currently running.
+litepool_workers{pool="batch \"a\""} 1
+litepool_workers{pool="default"} 1
+# TYPE litepool_workers_max gauge
+# HELP litepool_workers_max Maximum number of goroutines.
+litepool_workers_max{pool="batch \"a\""} 2
+litepool_workers_max{pool="default"} 1
+# TYPE litepool_workers_min gauge
+# HELP litepool_workers_min Minimum number of goroutines kept when auto-scaling.
+litepool_workers_min{pool="batch \"a\""} 1
+litepool_workers_min{pool="default"} 1
+# TYPE litepool_workers_idle gauge
+# HELP litepool_workers_idle Running goroutines with no queued or executing task.
+litepool_workers_idle{pool="batch \"a\""} 0
+litepool_workers_idle{pool="default"} 1
+# TYPE litepool_idle_slots gauge
+# HELP litepool_idle_slots Slots that can take a task right away.
+litepool_idle_slots{pool="batch \"a\""} 1
+litepool_idle_slots{pool="default"} 2
+# TYPE litepool_tasks_queued gauge
+# HELP litepool_tasks_queued Tasks waiting in the goroutine queues.
+litepool_tasks_queued{pool="batch \"a\""} 1
+litepool_tasks_queued{pool="default"} 0
+# TYPE litepool_tasks_executing gauge
+# HELP litepool_tasks_executing Tasks being executed.
+litepool_tasks_executing{pool="batch \"a\""} 1
+litepool_tasks_executing{pool="default"} 0
+# TYPE litepool_tasks_delayed gauge
+# HELP litepool_tasks_delayed Delayed tasks that have not fired yet.
+litepool_tasks_delayed{pool="batch \"a\""} 3
+litepool_tasks_delayed{pool="default"} 0
+# TYPE litepool_worker_queue_length gauge
+# HELP litepool_worker_queue_length Tasks waiting in the queue of each goroutine.
+litepool_worker_queue_length{pool="batch \"a\"",worker="0"} 1
+litepool_worker_queue_length{pool="batch \"a\"",worker="1"} 0
+litepool_worker_queue_length{pool="default",worker="0"} 0
+# TYPE litepool_tasks_executed counter
+# HELP litepool_tasks_executed Tasks executed.
+litepool_tasks_executed_total{pool="batch \"a\""} 5
+litepool_tasks_executed_total{pool="default"} 0
+# TYPE litepool_tasks_succeeded counter
+# HELP litepool_tasks_succeeded Tasks that finished without an error.
+litepool_tasks_succeeded_total{pool="batch \"a\""} 3
+litepool_tasks_succeeded_total{pool="default"} 0
+# TYPE litepool_tasks_failed counter
+# HELP litepool_tasks_failed Tasks that returned an error.
+litepool_tasks_failed_total{pool="batch \"a\""} 1
+litepool_tasks_failed_total{pool="default"} 0
+# TYPE litepool_tasks_panicked counter
+# HELP litepool_tasks_panicked Tasks that panicked.
+litepool_tasks_panicked_total{pool="batch \"a\""} 1
+litepool_tasks_panicked_total{pool="default"} 0
+# TYPE litepool_tasks_stolen counter
+# HELP litepool_tasks_stolen Tasks idle goroutines took from the queues of busy ones.
+litepool_tasks_stolen_total{pool="batch \"a\""} 2
+litepool_tasks_stolen_total{pool="default"} 0
+# TYPE litepool_submit_timeouts counter
+# HELP litepool_submit_timeouts Submissions that did not get a slot in time.
+litepool_submit_timeouts_total{pool="batch \"a\""} 4
+litepool_submit_timeouts_total{pool="default"} 0
+# TYPE litepool_busy_seconds counter
+# HELP litepool_busy_seconds Total time spent executing tasks.
+litepool_busy_seconds_total{pool="batch \"a\""} 1.5
+litepool_busy_seconds_total{pool="default"} 0
+# TYPE litepool_queue_wait_seconds histogram
+# HELP litepool_queue_wait_seconds Time from submission to the start of execution.
+` + bucketLines("litepool_queue_wait_seconds", a, func(i int) int64 {
+		// 0落在第0个桶，3µs落在(2µs, 4µs]
+		// 0 falls in bucket 0, 3µs in (2µs, 4µs]
+		if i < 2 {
+			return 1
+		}
+		return 2
+	}) + `litepool_queue_wait_seconds_sum{pool="batch \"a\""} 3e-06
+litepool_queue_wait_seconds_count{pool="batch \"a\""} 2
+` + bucketLines("litepool_queue_wait_seconds", def, none) + `litepool_queue_wait_seconds_sum{pool="default"} 0
+litepool_queue_wait_seconds_count{pool="default"} 0
+# TYPE litepool_exec_seconds histogram
+# HELP litepool_exec_seconds Execution time of tasks.
+` + bucketLines("litepool_exec_seconds", a, func(i int) int64 {
+		// 1.5ms落在(1.024ms, 2.048ms]，2s落在(1.048576s, 2.097152s]
+		// 1.5ms falls in (1.024ms, 2.048ms], 2s in (1.048576s, 2.097152s]
+		switch {
+		case i < 11:
+			return 0
+		case i < 21:
+			return 1
+		}
+		return 2
+	}) + `litepool_exec_seconds_sum{pool="batch \"a\""} 2.0015
+litepool_exec_seconds_count{pool="batch \"a\""} 2
+` + bucketLines("litepool_exec_seconds", def, none) + `litepool_exec_seconds_sum{pool="default"} 0
+litepool_exec_seconds_count{pool="default"} 0
+# EOF
+`
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, stats); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		gotLines, wantLines := strings.Split(got, "\n"), strings.Split(want, "\n")
+		for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+			if gotLines[i] != wantLines[i] {
+				t.Fatalf("line %d:\n got %s\nwant %s", i+1, gotLines[i], wantLines[i])
+			}
+		}
+		t.Fatalf("got %d lines, want %d", len(gotLines), len(wantLines))
+	}
+	// 抽查桶上限的格式
+	// Spot check the format of the bucket bounds
+	for _, le := range []string{`le="1e-06"`, `le="0.000128"`, `le="+Inf"`} {
+		if !strings.Contains(buf.String(), le) {
+			t.Fatalf("bucket %s missing", le)
+		}
+	}
+}
+
+// TestMetricsHandler 处理器使用OpenMetrics的Content-Type并输出协程池的指标
+// TestMetricsHandler serves the metrics of the pools with the OpenMetrics Content-Type.
+func TestMetricsHandler(t *testing.T) {
+	lp := NewPool(1, 1, WithName("web"))
+	defer lp.Close()
+	rec := httptest.NewRecorder()
+	MetricsHandler(lp).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != metricsContentType {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `litepool_workers_max{pool="web"} 1`+"\n") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
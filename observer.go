@@ -0,0 +1,181 @@
+package litepool
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// EventType 是Observer收到的事件类型
+// EventType is the kind of event an Observer receives.
+type EventType int
+
+const (
+	// EventSubmit 任务被提交，还没有取得空位
+	// EventSubmit: the task was submitted and has not got a slot yet.
+	EventSubmit EventType = iota
+	// EventDispatch 任务被分配给协程Worker
+	// EventDispatch: the task was handed to goroutine Worker.
+	EventDispatch
+	// EventStart 任务开始执行，Duration为从提交到开始执行的时间
+	// EventStart: the task started, Duration is the time since submission.
+	EventStart
+	// EventSuccess 任务执行成功，Duration为执行时间
+	// EventSuccess: the task succeeded, Duration is the execution time.
+	EventSuccess
+	// EventError 任务返回了错误，Duration为执行时间
+	// EventError: the task returned an error, Duration is the execution time.
+	EventError
+	// EventPanic 任务panic，Duration为执行时间
+	// EventPanic: the task panicked, Duration is the execution time.
+	EventPanic
+	// EventRetry 任务开始第Attempt次重试，Err为上一次的错误
+	// EventRetry: retry number Attempt of the task starts, Err is the previous error.
+	EventRetry
+	// EventSubmitTimeout 任务在SetAddTimeout设置的时间内没有等到空位
+	// EventSubmitTimeout: the task did not get a slot within the SetAddTimeout duration.
+	EventSubmitTimeout
+	// EventWorkerStart 协程Worker启动
+	// EventWorkerStart: goroutine Worker started.
+	EventWorkerStart
+	// EventWorkerStop 协程Worker退出
+	// EventWorkerStop: goroutine Worker exited.
+	EventWorkerStop
+	// EventPoolClose 协程池已经关闭
+	// EventPoolClose: the pool has shut down.
+	EventPoolClose
+)
+
+var eventNames = [...]string{
+	EventSubmit:        "submit",
+	EventDispatch:      "dispatch",
+	EventStart:         "start",
+	EventSuccess:       "success",
+	EventError:         "error",
+	EventPanic:         "panic",
+	EventRetry:         "retry",
+	EventSubmitTimeout: "submit_timeout",
+	EventWorkerStart:   "worker_start",
+	EventWorkerStop:    "worker_stop",
+	EventPoolClose:     "pool_close",
+}
+
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return "unknown"
+}
+
+// Event 描述协程池中发生的一件事，与任务无关的事件TaskID为0，与协程无关的事件Worker为-1
+// Event describes something that happened in the pool, TaskID is 0 for events without a task and Worker is -1 for events without a goroutine.
+type Event struct {
+	Type EventType
+	Time time.Time
+	Pool string // WithName设置的名称
+	// Name set with WithName.
+	Worker    int64
+	TaskID    uint64
+	TaskName  string
+	Priority  int
+	Submitted time.Time // 任务被提交的时间
+	// Time the task was submitted.
+	Duration time.Duration // 含义见EventType
+	// Meaning depends on the EventType.
+	Attempt int // EventRetry的重试次数
+	// Retry number of EventRetry.
+	Err error
+}
+
+// Observer 接收协程池的事件，用于日志、追踪和审计。
+// OnEvent在产生事件的协程中同步调用，可能持有协程池的锁，因此需要尽快返回，并且不能调用协程池的方法。
+// Observer receives the events of the pool, for logging, tracing and auditing.
+// OnEvent is called synchronously on the goroutine producing the event, possibly with the pool's lock held, so it must return quickly and must not call methods of the pool.
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc 让普通函数实现Observer
+// ObserverFunc lets an ordinary function act as an Observer.
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) OnEvent(e Event) { f(e) }
+
+// WithObserver 添加一个Observer，可以多次使用
+// WithObserver adds an Observer, it can be used more than once.
+func WithObserver(o Observer) PoolOption {
+	return func(lp *ListPool) {
+		lp.observers = append(lp.observers, o)
+	}
+}
+
+// begin 记录任务的提交时间，第一次提交时分配任务ID并交给Tracer，然后产生EventSubmit
+// begin records the submission time of the task, assigns its ID and hands it to the Tracer on the first submission, then emits EventSubmit.
+func (lp *ListPool) begin(ctx context.Context, opt *TaskOptions) {
+	opt.submitted = time.Now()
+	if opt.retrying {
+		// 重试沿用第一次提交的任务ID和Tracer的ctx
+		// A retry keeps the task ID and the Tracer ctx of the first submission
+		opt.retrying = false
+		lp.emitTask(EventSubmit, -1, opt, 0, nil)
+		return
+	}
+	atomic.StoreInt32(&opt.ended, 0)
+	opt.attempt = 0
+	opt.reload = nil
+	opt.afterRetry = nil
+	opt.attempts = nil
+	opt.firstSubmitted = opt.submitted
+	opt.id = atomic.AddUint64(&lp.taskID, 1)
+	lp.trace(ctx, opt)
+	lp.emitTask(EventSubmit, -1, opt, 0, nil)
+}
+
+// emit 将事件交给所有Observer
+// emit hands the event to every Observer.
+func (lp *ListPool) emit(e Event) {
+	if len(lp.observers) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	e.Pool = lp.name
+	for _, o := range lp.observers {
+		o.OnEvent(e)
+	}
+}
+
+// emitTask 产生一个与任务有关的事件
+// emitTask emits an event about a task.
+func (lp *ListPool) emitTask(typ EventType, worker int64, f *TaskOptions, d time.Duration, err error) {
+	if len(lp.observers) == 0 {
+		return
+	}
+	lp.emit(Event{
+		Type:      typ,
+		Worker:    worker,
+		TaskID:    f.id,
+		TaskName:  f.name,
+		Priority:  f.priority,
+		Submitted: f.submitted,
+		Duration:  d,
+		Err:       err,
+	})
+}
+
+// emitRetry 产生EventRetry，err为上一次执行的错误
+// emitRetry emits EventRetry, err being the error of the previous run.
+func (lp *ListPool) emitRetry(worker int64, f *TaskOptions, attempt int, err error) {
+	if len(lp.observers) == 0 {
+		return
+	}
+	lp.emit(Event{
+		Type:      EventRetry,
+		Worker:    worker,
+		TaskID:    f.id,
+		TaskName:  f.name,
+		Priority:  f.priority,
+		Submitted: f.submitted,
+		Attempt:   attempt,
+		Err:       err,
+	})
+}
@@ -1,159 +1,522 @@
 package litepool
 
 import (
-	"container/heap"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync/atomic"
 	"time"
 )
 
-func (lp *ListPool) run(n int64, index bool) error {
-	if len(lp.workRun) == 0 && !index {
+// startWorker 从workRun中取出一个未运行的协程并启动，调用时需持有lp.mutex
+// startWorker takes a stopped goroutine from workRun and starts it, lp.mutex must be held.
+func (lp *ListPool) startWorker() bool {
+	select {
+	case n := <-lp.workRun:
+		if err := lp.run(n); err != nil {
+			lp.workRun <- n
+			return false
+		}
+		return true
+	default:
 		// 进程池已满
 		// The process pool is full
-		return errors.New("协程池满了")
-	}
-	// 发送开启协程给job接口监听。当前版本未启用。
-	// Send the coroutine startup to the job interface listener. The current version is not enabled.
-	// lp.heap.statusAdd <- n
-	if lp.task[n] == nil {
-		// 初始化通道
-		// Initialize channel
-		lp.task[n] = make(chan *TaskOptions, lp.jobQueuelen+1)
+		return false
 	}
+}
+
+// run 启动编号为n的协程，调用时需持有lp.mutex
+// run starts goroutine n, lp.mutex must be held.
+func (lp *ListPool) run(n int64) error {
 	if lp.statusWorker[n] == nil {
 		// 初始化通道
 		// Initialize channel
 		lp.statusWorker[n] = make(chan struct{}, 1)
 	}
+	if len(lp.statusWorker[n]) > 0 {
+		// 上一次启动的协程还没有退出
+		// The goroutine started last time has not exited yet
+		return errors.New("协程仍在运行")
+	}
+	if lp.task[n] == nil {
+		// 初始化队列
+		// Initialize queue
+		lp.task[n] = newTaskQueue(lp.jobQueuelen+1, lp.aging)
+	}
+	if lp.quit[n] == nil {
+		lp.quit[n] = make(chan struct{}, 1)
+	}
 	lp.statusWorker[n] <- struct{}{} // 发送工作状态
 	// Send Work Status
-	// 堆优先算法压入
-	// Heap priority algorithm push
-	heap.Push(lp.heap, WorkerStatus{
-		Id:       n,
-		JobCount: 0,
-	})
-	lp.idle <- n // 发送空闲协程
-	// Send Idle Protocol
+	// 开始接收任务
+	// Start taking tasks
+	lp.accepting[n] = true
+	lp.workers++
+	lp.dispatcher.Add(n)
+	// 发送job队列（可用任务队列）给通道
+	// Send job queue (available task queue) to channel
+	lp.addSlots(lp.jobQueuelen + 1)
+	lp.wg.Add(1)
 	go func() {
+		lp.log(slog.LevelDebug, "worker started", n, nil)
+		lp.emit(Event{Type: EventWorkerStart, Worker: n})
 		defer func() {
+			lp.mutex.Lock()
 			// 收回工作状态，此时len lp.statusWorker[n]==0
 			// Retract the working state, at which point len lp.statusWorker[n]==0
-			if !lp.close {
-				<-lp.statusWorker[n]
-				// 收回可接收的任务
-				// Withdraw acceptable tasks
-				for i := 0; i < lp.jobQueuelen; i++ {
-					_ = <-lp.idleRun
-				}
-				<-lp.idle // 收回可用协程
-				// Retrieving available processes
-				lp.workRun <- n // 告诉通道我可以工作了
-				// Tell the channel that I can work now
-				lp.heap.statusDone <- n // 发送关闭协程给job接口监听
-				// Send the shutdown protocol to the job interface for listening
-			}
+			<-lp.statusWorker[n]
+			lp.workRun <- n // 告诉通道我可以工作了
+			// Tell the channel that I can work now
+			lp.mutex.Unlock()
+			lp.log(slog.LevelDebug, "worker stopped", n, nil)
+			lp.emit(Event{Type: EventWorkerStop, Worker: n})
+			lp.wg.Done()
 		}()
-		// 发送job队列（可用任务队列）给通道
-		// Send job queue (available task queue) to channel
-		for i := 0; i < lp.jobQueuelen; i++ {
-			// 发送可用
-			// Send available
-			lp.idleRun <- n
-		}
 		for {
 			select {
 			case <-lp.ctx.Done():
-				//close(lp.task[n])
 				//close(lp.statusWorker[n])
 				return
-			case <-lp.quit:
-				lp.heap.Delete(n) // 从job队列中删除
-				// Remove from job queue
-				// 收到了减少协程池的信号
-				// Received the signal to reduce the coroutine pool
-				// 判断是否有job
-				// Check if there's a job
-				if len(lp.task[n]) == 0 {
-					return
+			case <-lp.quit[n]:
+				// 收到了减少协程池的信号，此时已经不在堆中，不会再收到新任务
+				// Received the signal to reduce the coroutine pool, no new task arrives since it left the dispatcher
+				// 处理完剩余的job再退出
+				// Finish the remaining jobs before exiting
+				for f := lp.next(n); f != nil; f = lp.next(n) {
+					lp.exec(n, f)
 				}
-			case f, ok := <-lp.task[n]:
-				if !ok {
-					// 当lp.task 关闭，这里将为false
-					// When lp.task is closed, this will be false
-					return
+				return
+			case <-lp.task[n].signal:
+				for f := lp.next(n); f != nil; f = lp.next(n) {
+					lp.exec(n, f)
 				}
-				atomic.AddInt64(&lp.numCount[n], 1)
-				// 协程处理的任务计数
-				// Count of tasks processed by the coroutine
-				// 错误处理：防止panic导致工作协程终止
-				// Error handling: prevent panic causing worker coroutine to terminate
-				var err error
-				func() {
-					defer func() {
-						r := recover()
-						// 无论任务是否成功，都执行onComplete回调
-						// Execute the onComplete callback whether the task is successful or not
-						if f.onComplete != nil {
-							f.onComplete()
-						}
-						if r != nil && f.onError != nil {
-							// 执行错误的回调
-							// Execute the error callback
-							f.onError(&ErrHandle{
-								lp:  lp,
-								opt: f,
-							}, f.tg, fmt.Errorf("task panicked: %v", r))
-						}
-						if !lp.close {
-							if len(lp.task[n]) == 0 {
-								lp.idle <- n
-							} else {
-								lp.idleRun <- n
-							}
-						}
-						lp.heap.Done(n)
-					}()
-					start := time.Now()
-					err = f.task() // 执行任务
-					// Execute the task
-					lp.timeCount[n] += time.Since(start)
-					if f.onSuccess != nil && err == nil {
-						// 如果没有panic，执行成功的回调
-						// If there is no panic, execute the successful callback
-						f.onSuccess()
-					}
-					if err == nil && f.autoDone {
-						// 执行完毕success函数后才执行done
-						// Only execute done after the success function is completed
-						f.tg.wg.Done()
-					}
-					if err != nil && f.onError != nil {
-						// 执行错误的回调
-						// Execute the error callback
-						f.onError(&ErrHandle{
-							lp:  lp,
-							opt: f,
-						}, f.tg, err)
-					}
-				}()
 			}
 		}
 	}()
 	return nil
 }
 
-// Usage 用于输出每个协程的运行信息
-// Usage is used to print out the runtime information of each goroutine
+// retire 让任务最少的协程退出，调用时需持有lp.mutex
+// retire asks the least loaded goroutine to exit, lp.mutex must be held.
+func (lp *ListPool) retire() bool {
+	if lp.workers <= lp.minProcess || lp.workers <= 1 {
+		// 始终保持着有一个工作线程
+		// Always keep at least one worker
+		return false
+	}
+	n := int64(-1)
+	for i, ok := range lp.accepting {
+		if ok && (n < 0 || lp.outstanding[i] < lp.outstanding[n]) {
+			n = int64(i)
+		}
+	}
+	// 从dispatcher中删除，之后不会再分配任务给这个协程
+	// Remove from the dispatcher, no more tasks are assigned to this goroutine afterwards
+	lp.accepting[n] = false
+	lp.workers--
+	lp.dispatcher.Remove(n)
+	lp.takeSlots(lp.jobQueuelen + 1)
+	lp.quit[n] <- struct{}{}
+	return true
+}
+
+// addSlots 增加可接收任务的空位，优先抵扣未收回的空位，调用时需持有lp.mutex
+// addSlots adds free task slots, paying off slotDebt first, lp.mutex must be held.
+func (lp *ListPool) addSlots(c int) {
+	for i := 0; i < c; i++ {
+		lp.releaseSlot()
+	}
+}
+
+// takeSlots 收回空位，暂时被占用的空位记为slotDebt，调用时需持有lp.mutex
+// takeSlots reclaims free task slots, the ones currently in use are recorded in slotDebt, lp.mutex must be held.
+func (lp *ListPool) takeSlots(c int) {
+	for i := 0; i < c; i++ {
+		select {
+		case <-lp.idleRun:
+		default:
+			lp.slotDebt++
+		}
+	}
+}
+
+// releaseSlot 归还一个空位，有提交在等待时直接交给优先级最高的一个，调用时需持有lp.mutex
+// releaseSlot returns one task slot, handing it straight to the highest priority submission when some are waiting, lp.mutex must be held.
+func (lp *ListPool) releaseSlot() {
+	if lp.slotDebt > 0 {
+		lp.slotDebt--
+		return
+	}
+	if lp.waiters.hand() {
+		return
+	}
+	lp.idleRun <- struct{}{}
+}
+
+// dispatch 将任务交给Dispatcher选择的协程，调用者需已取得一个空位并持有lp.mutex，排到键后面的任务会归还这个空位
+// dispatch hands the task to the goroutine chosen by the Dispatcher, the caller must hold a slot and lp.mutex, a task queued behind its key gives the slot back.
+func (lp *ListPool) dispatch(opt *TaskOptions) bool {
+	if lp.waitKey(opt) {
+		// 同一个键的前一个任务还没有完成，排在它后面。等待的任务不占用空位，轮到它时接过前一个任务的空位
+		// An earlier task of the same key has not finished, wait behind it. Waiting tasks hold no slot, each takes over the slot of the task before it when its turn comes
+		lp.pending++
+		lp.releaseSlot()
+		return true
+	}
+	n, ok := lp.pick()
+	if !ok {
+		// 持有的空位属于正在退出的协程
+		// The slot held belongs to an exiting goroutine
+		return false
+	}
+	lp.holdKey(opt)
+	lp.pending++
+	lp.enqueue(n, opt)
+	return true
+}
+
+// enqueue 将已经计入pending的任务放入协程n的队列，调用时需持有lp.mutex
+// enqueue puts a task already counted in pending into the queue of goroutine n, lp.mutex must be held.
+func (lp *ListPool) enqueue(n int64, opt *TaskOptions) {
+	lp.outstanding[n]++
+	lp.dispatcher.Update(n, lp.outstanding[n])
+	lp.seq++
+	opt.seq = lp.seq
+	opt.queuedAt = time.Since(lp.start)
+	lp.task[n].push(opt)
+	lp.emitTask(EventDispatch, n, opt, 0, nil)
+	if lp.outstanding[n] > 1 {
+		// 任务排在其他任务后面，让空闲的协程来取
+		// The task waits behind others, let an idle goroutine take it
+		lp.wakeIdle(n)
+	}
+}
+
+// pick 返回Dispatcher选择的协程，选择的协程不能接收任务时依次查找，调用时需持有lp.mutex
+// pick returns the goroutine chosen by the Dispatcher, looking through the others when it cannot take the task, lp.mutex must be held.
+func (lp *ListPool) pick() (int64, bool) {
+	if n, ok := lp.dispatcher.Pick(); ok && n >= 0 && int(n) < len(lp.accepting) && lp.free(n) {
+		return n, true
+	}
+	for n := range lp.accepting {
+		if lp.free(int64(n)) {
+			return int64(n), true
+		}
+	}
+	return -1, false
+}
+
+// free 判断协程n是否在接收任务并且还有空位，调用时需持有lp.mutex
+// free reports whether goroutine n takes tasks and has room for one more, lp.mutex must be held.
+func (lp *ListPool) free(n int64) bool {
+	return lp.accepting[n] && lp.outstanding[n] <= lp.jobQueuelen
+}
+
+// freeSlots 返回接收任务的协程还能接收的任务数，调用时需持有lp.mutex
+// freeSlots returns how many more tasks the goroutines taking tasks can hold, lp.mutex must be held.
+func (lp *ListPool) freeSlots() int {
+	free := 0
+	for n, ok := range lp.accepting {
+		if ok {
+			free += lp.jobQueuelen + 1 - lp.outstanding[n]
+		}
+	}
+	return free
+}
+
+// jobs 返回接收任务的协程排队和正在执行的任务数，调用时需持有lp.mutex
+// jobs returns the queued and executing tasks of the goroutines taking tasks, lp.mutex must be held.
+func (lp *ListPool) jobs() int {
+	total := 0
+	for n, ok := range lp.accepting {
+		if ok {
+			total += lp.outstanding[n]
+		}
+	}
+	return total
+}
+
+// next 取出协程n队列中优先级最高的任务，正在放弃任务时直接放弃，队列为空时从其他协程取，没有任务时返回nil
+// next takes the highest priority task of goroutine n, abandoning tasks while aborting, stealing from other goroutines when the queue is empty, nil when there is no task.
+func (lp *ListPool) next(n int64) *TaskOptions {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	for {
+		f := lp.task[n].pop()
+		if f == nil {
+			// 自己的队列空了，从忙碌的协程中取
+			// The own queue is empty, take from a busy goroutine
+			if f = lp.steal(n); f == nil {
+				return nil
+			}
+		}
+		if lp.abort {
+			// 正在放弃排队中的任务，不再执行
+			// Queued tasks are being abandoned, do not run it
+			lp.abandon(n, f)
+			continue
+		}
+		lp.running++
+		return f
+	}
+}
+
+// finish 在任务结束或被放弃后归还它占用的空位，调用时需持有lp.mutex
+// finish gives back the slot of a task that finished or was abandoned, lp.mutex must be held.
+func (lp *ListPool) finish(n int64) {
+	lp.unload(n)
+	lp.settle()
+}
+
+// unload 减少协程n的任务计数，调用时需持有lp.mutex
+// unload decrements the task count of goroutine n, lp.mutex must be held.
+func (lp *ListPool) unload(n int64) {
+	lp.outstanding[n]--
+	lp.dispatcher.Update(n, lp.outstanding[n])
+}
+
+// settle 归还任务占用的空位并减少pending，调用时需持有lp.mutex
+// settle gives back the slot of a task and decrements pending, lp.mutex must be held.
+func (lp *ListPool) settle() {
+	lp.releaseSlot()
+	lp.unpend()
+}
+
+// unpend 减少pending，没有任务时通知正在等待的Shutdown，调用时需持有lp.mutex
+// unpend decrements pending and tells a draining Shutdown once no task is left, lp.mutex must be held.
+func (lp *ListPool) unpend() {
+	lp.pending--
+	if lp.pending == 0 && lp.drained != nil {
+		close(lp.drained)
+		lp.drained = nil
+	}
+}
+
+// abandon 放弃一个排队中的任务，调用时需持有lp.mutex
+// abandon drops a queued task without running it, lp.mutex must be held.
+func (lp *ListPool) abandon(n int64, f *TaskOptions) {
+	lp.abandoned = append(lp.abandoned, f)
+	f.end(ErrPoolClosed)
+	lp.unload(n)
+	lp.releaseKey(-1, f)
+}
+
+// exec 在协程n中执行一个由next取出的任务
+// exec runs one task taken by next on goroutine n.
+func (lp *ListPool) exec(n int64, f *TaskOptions) {
+	atomic.AddInt64(&lp.numCount[n], 1)
+	// 协程处理的任务计数
+	// Count of tasks processed by the coroutine
+	start := time.Now()
+	var elapsed time.Duration
+	var eh *ErrHandle
+	requeued := false // 任务已经重新交给协程池，键仍然由它占用
+	// The task is back in the pool and still holds its key
+	defer func() {
+		// 错误处理：防止回调panic导致工作协程终止
+		// Error handling: prevent a panicking callback from terminating the worker coroutine
+		if r := recover(); r != nil {
+			pe := asPanicError(r)
+			lp.log(slog.LevelError, "task callback panicked", n, f, slog.Any("panic", pe.Value), slog.String("stack", string(pe.Stack)))
+			f.end(pe)
+		}
+		lp.mutex.Lock()
+		lp.running--
+		if lp.execRecorder != nil {
+			lp.execRecorder.RecordExec(n, elapsed)
+		}
+		switch {
+		case !requeued && (eh == nil || !eh.scheduled):
+			lp.unload(n)
+			// 把键和空位交给同一个键的下一个任务，它在这个协程中执行
+			// Pass the key and the slot on to the next task of the same key, which runs on this goroutine
+			lp.releaseKey(n, f)
+		case f.key != "":
+			// 有键的任务等待重试时保留着空位
+			// A keyed task keeps its slot while waiting for a retry
+			lp.unload(n)
+		default:
+			lp.finish(n)
+		}
+		lp.mutex.Unlock()
+	}()
+	lp.emitTask(EventStart, n, f, start.Sub(f.submitted), nil)
+	lp.queueWait.record(start.Sub(f.submitted))
+	if f.tg != nil {
+		f.tg.queueWait.record(start.Sub(f.submitted))
+	}
+	// 执行任务，panic会被转换为PanicError，在单独的协程中panic时保留那里的调用栈
+	// Execute the task, a panic becomes a PanicError keeping the stack of the task's own goroutine
+	err := lp.safeInvoke(n, f)
+	elapsed = time.Since(start)
+	// 自动缩放检查时会并发读取，这里使用原子操作
+	// Read concurrently by the auto-scaling check, so it is updated atomically
+	atomic.AddInt64((*int64)(&lp.timeCount[n]), int64(elapsed))
+	lp.execTime.record(elapsed)
+	if f.tg != nil {
+		f.tg.execTime.record(elapsed)
+	}
+	pe, _ := err.(*PanicError)
+	switch {
+	case pe != nil:
+		atomic.AddInt64(&lp.panicCount[n], 1)
+		if f.tg != nil {
+			atomic.AddInt64(&f.tg.panics, 1)
+		}
+		lp.log(slog.LevelError, "task panicked", n, f,
+			slog.Duration("duration", elapsed), slog.Any("panic", pe.Value), slog.String("stack", string(pe.Stack)))
+		lp.emitTask(EventPanic, n, f, elapsed, err)
+	case err != nil:
+		atomic.AddInt64(&lp.failCount[n], 1)
+		lp.log(slog.LevelDebug, "task failed", n, f, slog.Duration("duration", elapsed), slog.Any("error", err))
+		lp.emitTask(EventError, n, f, elapsed, err)
+	default:
+		atomic.AddInt64(&lp.successCount[n], 1)
+		lp.emitTask(EventSuccess, n, f, elapsed, nil)
+	}
+	lp.recordAttempt(n, f, start, elapsed, err, pe != nil)
+	if err != nil && lp.retryLater(n, f, err) {
+		// 任务已经重新交给协程池，这里不能再使用f
+		// The task is back in the pool, f must not be used from here on
+		requeued = true
+		return
+	}
+	eh = lp.conclude(n, f, err, pe)
+}
+
+// conclude 在任务最终结束后调用回调，并把失败的任务交给死信队列，返回onError收到的ErrHandle，n<0表示没有协程
+// conclude runs the callbacks of a task that finished for good and hands a failed one to the dead-letter sink,
+// returning the ErrHandle given to onError, n<0 means no goroutine is involved.
+func (lp *ListPool) conclude(n int64, f *TaskOptions, err error, pe *PanicError) (eh *ErrHandle) {
+	defer func() {
+		// 防止回调panic导致工作协程终止，panic之前ErrReload安排的重试仍然有效
+		// Keep a panicking callback from terminating the worker, a retry ErrReload scheduled before the panic still stands
+		if r := recover(); r != nil {
+			cpe := asPanicError(r)
+			lp.log(slog.LevelError, "task callback panicked", n, f, slog.Any("panic", cpe.Value), slog.String("stack", string(cpe.Stack)))
+			if eh == nil || !eh.scheduled {
+				f.end(cpe)
+			}
+		}
+	}()
+	if f.afterRetry != nil {
+		// ErrReload发起的重试只把结果交给afterFunc
+		// Retries started by ErrReload only report to afterFunc
+		f.afterRetry(err)
+		if err == nil && f.autoDone {
+			f.tg.wg.Done()
+		}
+		if err != nil {
+			lp.deadLetter(n, f, err)
+		}
+		f.end(err)
+		return nil
+	}
+	if f.onSuccess != nil && err == nil {
+		// 如果没有panic，执行成功的回调
+		// If there is no panic, execute the successful callback
+		f.onSuccess()
+	}
+	if err == nil && f.autoDone {
+		// 执行完毕success函数后才执行done
+		// Only execute done after the success function is completed
+		f.tg.wg.Done()
+	}
+	// 无论任务是否成功，都执行onComplete回调
+	// Execute the onComplete callback whether the task is successful or not
+	if f.onComplete != nil {
+		f.onComplete()
+	}
+	if err != nil && f.onError != nil {
+		// 执行错误的回调
+		// Execute the error callback
+		eh = &ErrHandle{
+			lp:      lp,
+			opt:     f,
+			worker:  n,
+			err:     err,
+			class:   lp.classify(f, err),
+			attempt: f.attempt + 1,
+		}
+		f.onError(eh, f.tg, err)
+		if eh.scheduled {
+			// ErrReload安排了重试，重试的结果才是任务最终的结果
+			// ErrReload scheduled a retry, whose outcome is the final outcome of the task
+			return eh
+		}
+	} else if pe != nil && lp.panicHandler != nil {
+		// 任务没有设置onError时交给协程池的PanicHandler
+		// Tasks without onError fall back to the pool's PanicHandler
+		lp.panicHandler(lp.taskInfo(n, f), pe)
+	}
+	if err != nil {
+		lp.deadLetter(n, f, err)
+	}
+	f.end(err)
+	return eh
+}
+
+// Pending 返回已提交但还没有完成的任务数，包括还没有到期的延迟任务
+// Pending returns the number of submitted tasks that have not finished, delayed tasks that have not fired included.
+func (lp *ListPool) Pending() int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.pending + lp.delayed
+}
+
+// Usage 用于输出每个协程的运行信息，内容与Stats相同
+// Usage is used to print out the runtime information of each goroutine, the same information Stats returns
 func (lp *ListPool) Usage() {
-	for n, t := range lp.task {
-		// 输出指定协程的正在运行的任务数
-		// Print the number of tasks that are still running for a specified goroutine
-		fmt.Println(fmt.Sprintf("Goroutine %v, with a total of %v jobs", n, len(t)))
-		// 输出协程的ID，执行次数，以及总执行时间
-		// Print the ID of the goroutine, the number of executions, and the total execution time
-		fmt.Println("My goroutine ID is", n, "I have executed tasks", lp.numCount[n], "times", "My total execution time for tasks is:", lp.timeCount[n].Milliseconds(), "milliseconds")
+	fmt.Print(lp.Stats())
+}
+
+// call 执行任务，设置了执行超时时间时在单独的协程中执行，超时后不再等待，有键的任务通过inflight在返回后交出键
+// call runs the task, with an execution timeout it runs in its own goroutine and is no longer waited for after the timeout,
+// a keyed task passes its key on through inflight once it returns.
+func (lp *ListPool) call(ctx context.Context, f *TaskOptions) error {
+	if f.execTimeout <= 0 {
+		return f.task(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.execTimeout)
+	defer cancel()
+	type result struct {
+		err      error
+		panicked bool
+		r        interface{}
+	}
+	done := make(chan result, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{panicked: true, r: asPanicError(r)}
+			}
+		}()
+		done <- result{err: f.task(ctx)}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// 协程池关闭时取消，任务仍然算作执行中，等待它结束
+			// Cancelled by the pool shutting down, the task still counts as running so wait for it
+			res = <-done
+			break
+		}
+		if f.key != "" {
+			// 有键的任务返回之前同一个键的下一个任务和重试都不能开始，由releaseKey和redispatch等它返回
+			// Neither the next task of the key nor a retry may start before this one returns, releaseKey and redispatch wait for that
+			f.inflight = returned
+		}
+		return ErrExecTimeout
+	}
+	if res.panicked {
+		// 在工作协程中重新panic，交给exec统一处理
+		// Panic again on the worker goroutine so that exec handles it
+		panic(res.r)
 	}
+	return res.err
 }
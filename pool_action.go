@@ -1,49 +1,37 @@
 package litepool
 
 import (
+	"sync/atomic"
 	"time"
 )
 
 // 动态管理协程池的函数。
 // Dynamic goroutine pool management function.
-// 目前开发停滞，与job链接时存在BUG。
-// Development is currently stalled. There are bugs when interfacing with the job.
+// 定时取得负载快照，交给scalingPolicy决定新增或释放协程。
+// Periodically takes a load snapshot and lets scalingPolicy decide whether to add or release goroutines.
 func (lp *ListPool) monitorAndScale() {
 	ticker := time.NewTicker(AutoCheckScaleTime) // 用于自动扩展的计时器
 	// Timer for auto-scaling.
 	defer ticker.Stop()
+	var lastNum, lastTime int64 // 上一次检查时的任务总数和总执行时间
+	// Total task count and execution time at the previous check.
+	var avg time.Duration
 	for {
 		select {
 		case <-ticker.C:
-			workR := cap(lp.workRun) - len(lp.workRun) // 计算正在运行的协程数
-			// Calculate the number of running goroutines.
-			if workR == 0 {
+			num, busy := lp.execTotals()
+			if num > lastNum {
+				avg = time.Duration((busy - lastTime) / (num - lastNum))
+			}
+			lastNum, lastTime = num, busy
+			d := lp.scalingPolicy.Decide(lp.load(avg))
+			if d.Add <= 0 && d.Remove <= 0 {
 				continue
 			}
-			idleR := workR - len(lp.idle) // 计算正在运行的任务数
-			// Calculate the number of running tasks.
-			taskR := workR*lp.jobQueuelen - len(lp.idleRun) // 计算正在运行的任务数
-			// Calculate the number of tasks running.
-			bl := float32(taskR+idleR) / float32(workR*lp.jobQueuelen+workR) // 计算负载平衡
-			// Calculate the load balance.
-			if bl >= MinAutoAdd && workR < cap(lp.workRun) {
-				// 当一定比例的任务正在运行时，增加协程池的大小
-				// When a certain ratio of tasks is running, increase the size of the goroutine pool.
-				ad := int64(len(lp.workRun)) / (AutoAddScale * 100)
-				if ad == 0 {
-					ad = 1
-				}
-				lp.poolAction <- poolAction{add: ad}
-				lp.lastScaleUpTime = time.Now()
-			} else if bl < MaxAutoQuit && time.Since(lp.lastScaleUpTime) < TaskQuitCD {
-				//fmt.Println("任务较少，但在新增协程后的冷却时间内，因此不减少协程")
-				// "Tasks are few, but within the cooldown time after adding goroutines, so don't reduce the goroutines."
-			} else if bl < MaxAutoQuit && time.Since(lp.lastScaleUpTime) >= TaskQuitCD {
-				qu := int64(workR) / (AutoQuitScale * 100)
-				if qu == 0 {
-					qu = 1
-				}
-				lp.poolAction <- poolAction{quit: qu}
+			select {
+			case lp.poolAction <- poolAction{add: int64(max(d.Add, 0)), quit: int64(max(d.Remove, 0))}:
+			case <-lp.ctx.Done():
+				return
 			}
 		case <-lp.ctx.Done():
 			return
@@ -51,6 +39,35 @@ func (lp *ListPool) monitorAndScale() {
 	}
 }
 
+// load 返回当前的负载快照
+// load returns a snapshot of the current load.
+func (lp *ListPool) load(avg time.Duration) PoolLoad {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return PoolLoad{
+		Workers:        lp.workers, // 正在运行的协程数
+		MinWorkers:     lp.minProcess,
+		MaxWorkers:     lp.maxProcess,
+		SlotsPerWorker: lp.jobQueuelen + 1,
+		IdleSlots:      len(lp.idleRun),
+		QueuedJobs:     lp.jobs() + lp.reserved, // 排队和正在运行的任务数，包括任务组预留的空位
+		AvgExecTime:    avg,
+		LastScaleUp:    lp.lastScaleUpTime,
+		LastScaleDown:  lp.lastScaleDownTime,
+		Now:            time.Now(),
+	}
+}
+
+// execTotals 返回所有协程执行过的任务总数和总执行时间（纳秒）
+// execTotals returns the number of tasks executed by all goroutines and their total execution time in nanoseconds.
+func (lp *ListPool) execTotals() (num, busy int64) {
+	for n := range lp.numCount {
+		num += atomic.LoadInt64(&lp.numCount[n])
+		busy += atomic.LoadInt64((*int64)(&lp.timeCount[n]))
+	}
+	return num, busy
+}
+
 func (g *ListPool) poolActionr() {
 	//这是一个操作协程池新增和释放的任务
 	for {
@@ -58,24 +75,29 @@ func (g *ListPool) poolActionr() {
 		case <-g.ctx.Done():
 			return
 		case w := <-g.poolAction:
-			if w.add > 0 {
-				for i := int64(0); i < w.add; i++ {
-					if len(g.workRun) == 0 {
-						break
-					}
-					n := <-g.workRun
-					//g.task[n] = make(chan *TaskOptions)
-					g.run(n, false)
+			g.mutex.Lock()
+			added, quit := 0, 0
+			for i := int64(0); i < w.add; i++ {
+				if !g.startWorker() {
+					break
 				}
-			} else {
-				for i := int64(0); i < w.quit; i++ {
-					if cap(g.workRun)-len(g.workRun) > 1 {
-						//始终保持着有一个工作线程
-						//fmt.Println("quit")
-						g.quit <- struct{}{}
-					}
+				added++
+			}
+			for i := int64(0); i < w.quit; i++ {
+				if !g.retire() {
+					break
 				}
+				quit++
+			}
+			if added > 0 {
+				g.lastScaleUpTime = time.Now()
+				g.logger.Info("pool scaled up", "added", added, "workers", g.workers)
+			}
+			if quit > 0 {
+				g.lastScaleDownTime = time.Now()
+				g.logger.Info("pool scaled down", "removed", quit, "workers", g.workers)
 			}
+			g.mutex.Unlock()
 		}
 	}
 }
@@ -1,61 +1,130 @@
 package litepool
 
+import (
+	"context"
+	"log/slog"
+)
+
+// ShutdownMode 决定关闭协程池时如何处理排队中的任务
+// ShutdownMode decides what happens to queued tasks when the pool shuts down.
+type ShutdownMode int
+
+const (
+	// ShutdownDrain 执行完所有排队中的任务后关闭，ctx到期时放弃剩余的任务
+	// ShutdownDrain runs every queued task before closing, the rest are abandoned once ctx expires.
+	ShutdownDrain ShutdownMode = iota
+	// ShutdownAbort 放弃所有排队中的任务，只等待正在执行的任务结束
+	// ShutdownAbort abandons every queued task and only waits for the running ones.
+	ShutdownAbort
+)
+
+func (m ShutdownMode) String() string {
+	if m == ShutdownAbort {
+		return "abort"
+	}
+	return "drain"
+}
+
 // 添加一个方法来优雅地关闭协程池
+// Close waits for every TaskGroup and then shuts the pool down, running all queued tasks.
 func (lp *ListPool) Close() {
-	for _, tg := range lp.TaskGroupList {
+	lp.mutex.Lock()
+	groups := lp.TaskGroupList
+	lp.mutex.Unlock()
+	for _, tg := range groups {
 		tg.Wait()
 	}
 	//printMemUsage()
+	_, _ = lp.Shutdown(context.Background(), ShutdownDrain)
+}
+
+// Shutdown 停止接收新任务，并按照mode执行或放弃排队中的任务。
+// 返回从未执行的任务，包括还没有到期的延迟任务，ctx到期时返回ctx.Err()，协程池已经关闭时返回ErrPoolClosed。
+// 被放弃的任务以ErrPoolClosed结束，但不会调用onError、onComplete、onSuccess，也不会交给死信队列：
+// SubmitTask返回的Future以ErrPoolClosed完成，通过Go或GoTask加入的任务会对TaskGroup执行Done并记录ErrPoolClosed，
+// 固定数量的任务组会记录ErrPoolClosed，但SetAutoDone不会执行Done，需要调用方根据返回的任务自己处理。
+// 正在等待重试的任务已经执行过，不算被放弃，它们以ErrPoolClosed作为最终的错误结束，与重试用完一样调用onError、onComplete并交给死信队列。
+// Shutdown stops accepting tasks and runs or abandons the queued ones according to mode.
+// It returns the tasks that never ran, delayed tasks that have not fired included, ctx.Err() once ctx expires and ErrPoolClosed if the pool is already closed.
+// Abandoned tasks end with ErrPoolClosed but get no onError, onComplete or onSuccess and do not reach the dead-letter sink:
+// a Future from SubmitTask resolves with ErrPoolClosed, a task added with Go or GoTask is marked done on its TaskGroup and ErrPoolClosed is recorded,
+// a fixed-count group records ErrPoolClosed but SetAutoDone does not mark the task done, the caller handles the returned tasks itself.
+// Tasks waiting for a retry have already run and are not abandoned,
+// they end with ErrPoolClosed as their final error, calling onError and onComplete and reaching the dead-letter sink as if their retries had run out.
+func (lp *ListPool) Shutdown(ctx context.Context, mode ShutdownMode) ([]*TaskOptions, error) {
+	lp.mutex.Lock()
+	if lp.close {
+		lp.mutex.Unlock()
+		return nil, ErrPoolClosed
+	}
+	// Step 1: Stop accepting tasks
 	lp.close = true
-	// Step 1: Cancel the associated context
-	if lp.cancel != nil {
-		lp.cancel()
+	close(lp.done)
+	// 还没有到期的任务不再等待，已经到期正在提交的任务会收到ErrPoolClosed
+	// Tasks that have not fired are not waited for, due tasks being submitted get ErrPoolClosed
+	retries := lp.stopTimers()
+	lp.mutex.Unlock()
+	for _, dt := range retries {
+		lp.dropRetry(dt.opt, dt.held, ErrPoolClosed)
 	}
+	lp.firing.Wait()
+	lp.mutex.Lock()
 
-	// Step 2: Close all the channels
-	//close(lp.quit)
-	//return
-	for _, ch := range lp.task {
-		for i := 0; i < len(ch); i++ {
-			_ = <-ch
+	// Step 2: Wait for the queued tasks in drain mode
+	var err error
+	if mode == ShutdownDrain && lp.pending > 0 {
+		drained := make(chan struct{})
+		lp.drained = drained
+		lp.mutex.Unlock()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
 		}
-		//close(ch)
+		lp.mutex.Lock()
+		lp.drained = nil
 	}
-	for _, ch := range lp.statusWorker {
-		for i := 0; i < len(ch); i++ {
-			_ = <-ch
+
+	// Step 3: Abandon whatever is still queued
+	lp.abort = true
+	lp.abandonKeyed()
+	for n, q := range lp.task {
+		if q == nil {
+			continue
 		}
-		//close(ch)
-	}
-	//close(lp.poolAction)
-	for i := 0; i < len(lp.idleRun); i++ {
-		<-lp.idleRun
-	}
-	//close(lp.idleRun)
-	for i := 0; i < len(lp.workRun); i++ {
-		<-lp.workRun
-	}
-	//close(lp.workRun)
-	for i := 0; i < len(lp.idle); i++ {
-		<-lp.idle
-	}
-	//close(lp.idle)
-
-	// Step 3: Wait for all goroutines to complete
-
-	// Step 4: Clean up resources
-	//lp.task = nil
-	//lp.numCount = nil
-	//lp.timeCount = nil
-	//lp.statusWorker = nil
-	//lp.poolAction = nil
-	//lp.quit = nil
-	//lp.idleRun = nil
-	//lp.workRun = nil
-	//lp.idle = nil
-	if lp.heap != nil {
-		lp.heap.Close()
-		//lp.heap = nil
-	}
-	//lp = nil
+		for f := q.pop(); f != nil; f = q.pop() {
+			lp.abandon(int64(n), f)
+		}
+	}
+	abandoned := lp.abandoned
+	lp.abandoned = nil
+	lp.mutex.Unlock()
+
+	// Step 4: Cancel the associated context and wait for all goroutines to complete
+	lp.cancel()
+	exited := make(chan struct{})
+	go func() {
+		lp.wg.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	for _, f := range abandoned {
+		lp.log(slog.LevelDebug, "task dropped on close", -1, f)
+	}
+	if len(abandoned) > 0 {
+		lp.logger.Warn("tasks dropped on close", "count", len(abandoned), "mode", mode.String())
+	}
+	if err != nil {
+		lp.logger.Warn("pool shutdown incomplete", "error", err)
+	}
+	lp.logger.Info("pool closed")
+	lp.emit(Event{Type: EventPoolClose, Worker: -1})
+	return abandoned, err
 }
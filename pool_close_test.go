@@ -0,0 +1,168 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// submitMany 从多个协程并发提交任务，返回提交成功和被拒绝的数量
+// submitMany submits tasks from several goroutines at once, returning how many were accepted and how many were rejected.
+func submitMany(lp *ListPool, n int, task func() error) (accepted, rejected int64) {
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < n; i += 4 {
+				opt := new(TaskOptions).SetTask(task).SetPriority(i % 3)
+				if i%5 == 0 {
+					opt.SetKey("k" + string(rune('a'+i%3)))
+				}
+				if err := lp.AddTask(opt); err != nil {
+					atomic.AddInt64(&rejected, 1)
+				} else {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	return accepted, rejected
+}
+
+// TestShutdownDrainAccounting 排队中的任务全部执行，还没有到期的延迟任务被放弃
+// TestShutdownDrainAccounting runs every queued task and abandons delayed tasks that have not fired.
+func TestShutdownDrainAccounting(t *testing.T) {
+	lp := NewPool(3, 4)
+	var ran int64
+	accepted, _ := submitMany(lp, 200, func() error {
+		time.Sleep(100 * time.Microsecond)
+		atomic.AddInt64(&ran, 1)
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		if _, err := lp.AddTaskAfter(time.Hour, new(TaskOptions).SetTask(func() error { return nil })); err != nil {
+			t.Fatal(err)
+		}
+	}
+	abandoned, err := lp.Shutdown(context.Background(), ShutdownDrain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran != accepted || len(abandoned) != 5 {
+		t.Fatalf("ran %d of %d, abandoned %d of 5 delayed", ran, accepted, len(abandoned))
+	}
+	if p := lp.Pending(); p != 0 {
+		t.Fatalf("pending %d after shutdown", p)
+	}
+}
+
+// TestShutdownAbortAccounting 提交的同时放弃，执行的任务数加放弃的任务数等于提交成功的任务数
+// TestShutdownAbortAccounting aborts while tasks are being submitted, tasks run plus tasks abandoned equals tasks accepted.
+func TestShutdownAbortAccounting(t *testing.T) {
+	lp := NewPool(3, 4)
+	var ran int64
+	var abandoned []*TaskOptions
+	var shutdownErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(5 * time.Millisecond)
+		abandoned, shutdownErr = lp.Shutdown(context.Background(), ShutdownAbort)
+	}()
+	accepted, rejected := submitMany(lp, 2000, func() error {
+		time.Sleep(100 * time.Microsecond)
+		atomic.AddInt64(&ran, 1)
+		return nil
+	})
+	<-done
+	if shutdownErr != nil {
+		t.Fatal(shutdownErr)
+	}
+	if accepted+rejected != 2000 || ran+int64(len(abandoned)) != accepted {
+		t.Fatalf("accepted %d rejected %d ran %d abandoned %d", accepted, rejected, ran, len(abandoned))
+	}
+}
+
+// TestShutdownDrainTimeout ctx到期时放弃剩余的任务，执行的任务数加放弃的任务数等于提交的任务数
+// TestShutdownDrainTimeout abandons the remaining tasks once ctx expires, tasks run plus tasks abandoned equals tasks submitted.
+func TestShutdownDrainTimeout(t *testing.T) {
+	lp := NewPool(2, 5)
+	var ran int64
+	for i := 0; i < 12; i++ {
+		if err := lp.AddTask(new(TaskOptions).SetTask(func() error {
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt64(&ran, 1)
+			return nil
+		})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	abandoned, err := lp.Shutdown(ctx, ShutdownDrain)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	// 正在执行的任务在Shutdown返回后才结束
+	// Tasks that were running finish after Shutdown returns
+	lp.wg.Wait()
+	if int(atomic.LoadInt64(&ran))+len(abandoned) != 12 {
+		t.Fatalf("ran %d abandoned %d", ran, len(abandoned))
+	}
+}
+
+// TestShutdownAbandonedTasks 被放弃的任务以ErrPoolClosed结束，Future完成，Go加入的任务执行Done，但不调用回调
+// TestShutdownAbandonedTasks ends abandoned tasks with ErrPoolClosed, resolving Futures and marking Go tasks done, without calling their callbacks.
+func TestShutdownAbandonedTasks(t *testing.T) {
+	lp := NewPool(1, 5)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		close(started)
+		<-block
+		return nil
+	}))
+	<-started
+
+	var callbacks int32
+	count := func() { atomic.AddInt32(&callbacks, 1) }
+	onError := func(*ErrHandle, *TaskGroup, error) { count() }
+	fu := SubmitTask(lp, new(TaskOptions).SetOnError(onError).SetOnComplete(count), func(ctx context.Context) (int, error) {
+		return 1, nil
+	})
+	group := lp.NewTaskGroupContext(context.Background())
+	group.GoTask(group.NewTaskOptions().SetOnError(onError).SetOnComplete(count).SetTask(func() error { return nil }))
+	fixed := lp.NewTaskGroup(1)
+	if err := lp.AddTask(fixed.NewTaskOptions().SetAutoDone().SetOnSuccess(count).SetTask(func() error { return nil })); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+	abandoned, err := lp.Shutdown(context.Background(), ShutdownAbort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(abandoned) != 3 {
+		t.Fatalf("abandoned %d, want 3", len(abandoned))
+	}
+	if _, err := fu.Get(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Future: %v", err)
+	}
+	if err := group.Wait(); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Go group: %v", err)
+	}
+	if err := fixed.Err(); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("fixed-count group: %v", err)
+	}
+	if callbacks != 0 {
+		t.Fatalf("%d callbacks called for abandoned tasks", callbacks)
+	}
+}
@@ -2,6 +2,7 @@ package litepool
 
 import (
 	"context"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -9,40 +10,130 @@ import (
 // ListPool 结构体用于管理和操作协程池
 // The ListPool structure is used to manage and operate a goroutine pool.
 type ListPool struct {
-	task []chan *TaskOptions // 每个协程都有自己的专属chan，用于大并发情况下避免竞争
-	// Each goroutine has its own dedicated channel, used to avoid contention in high concurrency scenarios.
+	name string // 协程池的名称，用于区分同一进程中的多个协程池
+	// Name of the pool, tells several pools in one process apart.
+	task []*taskQueue // 每个协程都有自己的专属队列，按照优先级出队
+	// Each goroutine has its own dedicated queue, tasks leave it by priority.
 	numCount []int64 // 记录每个协程的任务计数
 	// Record task count for each goroutine.
 	timeCount []time.Duration // 记录每个协程的执行时间
 	// Record execution time for each goroutine.
-	statusWorker []chan struct{} // 记录每个协程的状态
-	// Record the status of each goroutine.
+	successCount []int64 // 记录每个协程成功的任务数
+	// Record successful tasks for each goroutine.
+	failCount []int64 // 记录每个协程返回错误的任务数
+	// Record tasks that returned an error for each goroutine.
+	panicCount []int64 // 记录每个协程panic的任务数
+	// Record panicked tasks for each goroutine.
+	stealCount []int64 // 记录每个协程从其他协程取来的任务数
+	// Tasks each goroutine took from other goroutines.
+	submitTimeouts int64 // 提交超时的次数
+	// Number of submissions that timed out.
+	queueWait histogram // 从提交到开始执行的时间
+	// Time from submission to the start of execution.
+	execTime histogram // 任务的执行时间
+	// Execution time of tasks.
+	logger *slog.Logger // WithLogger设置的日志
+	// Logger set with WithLogger.
+	panicHandler PanicHandler // 任务panic并且没有设置onError时调用
+	// Called when a task panics and has no onError.
+	tracer Tracer // WithTracer设置的Tracer
+	// Tracer set with WithTracer.
+	classifier ErrorClassifier // WithErrorClassifier设置的错误分类方式
+	// Error classifier set with WithErrorClassifier.
+	classRetry map[ErrorClass]*RetryPolicy // WithRetryPolicyFor设置的重试方式
+	// Retry policies set with WithRetryPolicyFor.
+	deadLetters DeadLetterSink // WithDeadLetter设置的死信队列
+	// Dead-letter sink set with WithDeadLetter.
+	observers []Observer // WithObserver添加的Observer
+	// Observers added with WithObserver.
+	taskID uint64 // 最近分配的任务ID
+	// Last task ID assigned.
+	groupID uint64 // 最近分配的任务组ID
+	// Last task group ID assigned.
+	statusWorker []chan struct{} // 记录每个协程的状态，协程运行时通道内有一个值
+	// Record the status of each goroutine, the channel holds one value while the goroutine is running.
 	poolAction chan poolAction // 用于管理协程池的通道
 	// Channel used for managing the goroutine pool.
-	quit chan struct{} // 关闭通道，用于停止协程
-	// Closing channel, used to stop the goroutines.
+	quit []chan struct{} // 每个协程的退出通道，收到后处理完剩余任务再退出
+	// Per-goroutine quit channel, the goroutine finishes its remaining tasks and then exits.
 	lastScaleUpTime time.Time // 记录协程池最后一次增加协程的时间
 	// Records the last time the goroutine pool scaled up.
+	lastScaleDownTime time.Time // 记录协程池最后一次释放协程的时间
+	// Records the last time the goroutine pool scaled down.
+	scalingPolicy ScalingPolicy // 自动缩放策略
+	// Auto-scaling policy.
+	scalingSet bool // 是否通过WithScalingPolicy设置了缩放策略
+	// Whether a policy was set with WithScalingPolicy.
 	ctx context.Context // 上下文，常用于协程的生命周期管理
 	// Context, commonly used for goroutine lifecycle management.
 	cancel context.CancelFunc // 与上下文配合使用的取消函数
 	// Cancel function to be used in conjunction with the context.
-	close bool // 指示协程池是否关闭
-	// Indicates whether the goroutine pool is closed.
-	idleRun chan int64 // 空闲协程的通道，表示可以执行任务的协程
-	// Channel of idle goroutines, indicating goroutines that can execute tasks.
+	close bool // 指示协程池是否关闭，由lp.mutex保护
+	// Indicates whether the goroutine pool is closed, guarded by lp.mutex.
+	done chan struct{} // 开始关闭时关闭此通道，唤醒正在等待空位的提交
+	// Closed when shutdown starts, wakes up submissions waiting for a slot.
+	abort bool // 放弃排队中的任务，由lp.mutex保护
+	// Abandon queued tasks, guarded by lp.mutex.
+	abandoned []*TaskOptions // 关闭时放弃的任务
+	// Tasks abandoned during shutdown.
+	drained chan struct{} // 关闭时未完成的任务数变为0后关闭此通道
+	// Closed once no task is left unfinished during shutdown.
+	pending int // 已分配给协程但未完成的任务数
+	// Tasks handed to goroutines that have not finished yet.
+	running int // 正在执行的任务数
+	// Tasks being executed.
+	seq uint64 // 任务的入队序号，同一优先级按序号先进先出
+	// Enqueue sequence of tasks, FIFO within the same priority.
+	start time.Time // 协程池创建的时间，任务的入队时间相对于它记录
+	// Creation time of the pool, enqueue times of tasks are relative to it.
+	aging time.Duration // 任务每排队这么久优先级相当于提高1，为0时不提高
+	// Every aging a task waits counts as one extra priority level, zero disables aging.
+	timers *timerQueue // AddTaskAfter和AddTaskAt添加的还没有到期的任务
+	// Tasks added by AddTaskAfter and AddTaskAt that have not fired yet.
+	timerWake chan struct{} // 最早到期的任务变化时唤醒计时协程
+	// Wakes the timer goroutine when the earliest task changes.
+	delayed int // timers中还没有到期的延迟任务数，不包括周期任务
+	// Delayed tasks in timers that have not fired, recurring tasks excluded.
+	firing sync.WaitGroup // 已经到期正在提交的任务
+	// Due tasks that are being submitted.
+	wg sync.WaitGroup // 等待所有协程退出
+	// Waits for all goroutines to exit.
+	idleRun chan struct{} // 可接收任务的空位，每个运行中的协程提供jobQueuelen+1个
+	// Free task slots, each running goroutine contributes jobQueuelen+1 of them.
+	waiters *waiterQueue // 没有空位时等待空位的提交，按优先级排序
+	// Submissions waiting for a slot when none is free, ordered by priority.
+	slotDebt int // 协程退出时尚未收回的空位数量，归还空位时优先抵扣
+	// Slots not yet reclaimed from exiting goroutines, paid off before slots are returned.
 	workRun chan int64 // 通道，代表这个协程可以启动
 	// Channel, indicating that this goroutine can start.
 	maxProcess int // 最大处理数量
 	// Maximum processing count.
+	minProcess int // 自动缩放时保留的最少协程数量
+	// Minimum number of goroutines kept when auto-scaling.
 	jobQueuelen int // 工作队列的长度
 	// Length of the job queue.
-	idle chan int64 // 空闲协程的通道
-	// Channel for idle goroutines.
 	mutex sync.Mutex // 互斥锁，用于同步
 	// Mutex for synchronization.
-	heap *IntHeap // job的优先级算法
-	// Priority algorithm for jobs.
+	addMutex sync.Mutex // 任务组申请空位时使用，避免多个任务组互相占用空位
+	// Used while a task group reserves slots, so that groups do not hold each other's slots.
+	reserved int // 任务组已预留但还没有分配任务的空位
+	// Slots reserved by a task group that have no task dispatched yet.
+	dispatcher Dispatcher // 选择接收任务的协程
+	// Picks the goroutine that receives a task.
+	execRecorder ExecTimeRecorder // dispatcher实现了ExecTimeRecorder时不为nil
+	// Non-nil when dispatcher implements ExecTimeRecorder.
+	outstanding []int // 每个协程排队和正在执行的任务数
+	// Queued plus executing tasks of each goroutine.
+	accepting []bool // 协程是否在接收任务，正在退出的协程为false
+	// Whether each goroutine takes tasks, false for exiting ones.
+	workers int // 接收任务的协程数
+	// Number of goroutines taking tasks.
+	stealing bool // 空闲的协程是否从其他协程取任务
+	// Whether idle goroutines take tasks from other goroutines.
+	keys map[string]*keyState // SetKey设置的键的租约
+	// Leases of the keys set with SetKey.
+	keyWaiting int // 等待同一个键的前一个任务结束的任务数
+	// Tasks waiting for an earlier task of the same key to finish.
 	TaskGroupList []*TaskGroup
 }
 
@@ -1,60 +1,89 @@
 package litepool
 
 import (
-	"container/heap"
 	"context"
+	"log/slog"
 	"sync"
 	"time"
 )
 
-func NewPool(maxProcess int64, jobQueuelen int) *ListPool {
+func NewPool(maxProcess int64, jobQueuelen int, opts ...PoolOption) *ListPool {
 	// 使用给定的背景创建一个新的带取消功能的上下文。
 	// Create a new context with cancellation using the provided background.
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// 创建一个长度为maxProcess的TaskOptions通道数组。
-	// Create a slice of TaskOptions channels with a length of maxProcess.
-	taskChans := make([]chan *TaskOptions, maxProcess)
+	// 创建一个长度为maxProcess的任务队列数组。
+	// Create a slice of task queues with a length of maxProcess.
+	taskChans := make([]*taskQueue, maxProcess)
 
 	g := &ListPool{
-		task: taskChans, // 任务通道
-		// Task channels
+		task: taskChans, // 任务队列
+		// Task queues
 		numCount:     make([]int64, maxProcess),
 		timeCount:    make([]time.Duration, maxProcess),
+		successCount: make([]int64, maxProcess),
+		failCount:    make([]int64, maxProcess),
+		panicCount:   make([]int64, maxProcess),
+		stealCount:   make([]int64, maxProcess),
 		statusWorker: make([]chan struct{}, maxProcess),
-		quit:         make(chan struct{}), // 退出通道
-		// Exit channel
+		quit:         make([]chan struct{}, maxProcess), // 退出通道
+		// Exit channels
 		poolAction: make(chan poolAction), // 工作通道
 		// Work channel
-		ctx:     ctx,
-		cancel:  cancel,
-		idleRun: make(chan int64, maxProcess*int64(jobQueuelen+1)), // 可以处理任务的协程
-		idle:    make(chan int64, maxProcess*int64(jobQueuelen+1)), // 可以处理任务的协程
-		// Goroutines that can handle tasks
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		start:     time.Now(),
+		aging:     PriorityAging,
+		timers:    &timerQueue{},
+		timerWake: make(chan struct{}, 1),
+		idleRun:   make(chan struct{}, maxProcess*int64(jobQueuelen+1)), // 可以接收任务的空位
+		// Slots that can accept tasks
 		workRun: make(chan int64, maxProcess), // 可以工作的协程
 		// Goroutines that can work
-		jobQueuelen: jobQueuelen,
-		maxProcess:  int(maxProcess),
-		mutex:       sync.Mutex{},
-		heap:        NewIntHeap(maxProcess, int64(jobQueuelen)), // 创建一个新的整数堆
-		// Create a new integer heap
+		jobQueuelen:   jobQueuelen,
+		maxProcess:    int(maxProcess),
+		minProcess:    int(maxProcess),
+		scalingPolicy: NewThresholdPolicy(),
+		logger:        slog.New(discardHandler{}),
+		mutex:         sync.Mutex{},
+		dispatcher:    NewLeastLoadedDispatcher(),
+		outstanding:   make([]int, maxProcess),
+		accepting:     make([]bool, maxProcess),
+		stealing:      true,
 	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.waiters = &waiterQueue{aging: g.aging}
 
-	// 初始化整数堆
-	// Initialize the integer heap
-	heap.Init(g.heap)
+	g.dispatcher.Init(int(maxProcess), jobQueuelen+1)
+	g.execRecorder, _ = g.dispatcher.(ExecTimeRecorder)
 
 	for i := int64(0); i < maxProcess; i++ {
-		g.run(i, true)
+		g.workRun <- i
+	}
+	g.mutex.Lock()
+	for i := 0; i < g.minProcess; i++ {
+		g.startWorker()
 	}
+	g.mutex.Unlock()
 
-	// 以下是一些被注释掉的goroutine，它们是为了协程池的其他功能，如监视和自动调整大小。
-	// The following are some commented out goroutines that are for other features of the goroutine pool, like monitoring and auto-scaling.
-	//go g.heap.jobQueueStatus(ctx)
-	//go g.monitorAndScale() // 运行一个自动调整协程池大小的任务
-	// Run a task to auto-scale the goroutine pool size
-	//go g.poolActionr()     // 协程管理任务
-	// Goroutine management task
+	go g.runTimers() // 延迟任务的计时协程
+	// Timer goroutine for delayed tasks
+	if g.scalingSet && g.minProcess >= g.maxProcess {
+		// 设置了策略却没有可以伸缩的范围，策略不会生效
+		// A policy was set but there is no room to scale, it would never take effect
+		g.logger.Warn("scaling policy has no effect, minProcess is not below maxProcess", "workers", g.maxProcess)
+	}
+	if g.minProcess < g.maxProcess || g.scalingSet {
+		// 可以伸缩或者设置了策略时才启动自动调整协程池大小的任务
+		// The auto-scaling goroutines run when the pool can grow or shrink or a policy was set
+		go g.monitorAndScale() // 运行一个自动调整协程池大小的任务
+		// Run a task to auto-scale the goroutine pool size
+		go g.poolActionr() // 协程管理任务
+		// Goroutine management task
+	}
 
 	return g
 }
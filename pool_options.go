@@ -0,0 +1,67 @@
+package litepool
+
+import "time"
+
+// PoolOption 用于在NewPool时配置协程池
+// PoolOption configures a ListPool when it is created by NewPool.
+type PoolOption func(*ListPool)
+
+// WithMinProcess 设置协程池启动时的协程数量，同时也是自动缩放时保留的最少协程数量。
+// 小于maxProcess时协程池会根据负载在minProcess和maxProcess之间自动伸缩。
+// WithMinProcess sets the number of goroutines started with the pool, which is also the minimum kept when scaling down.
+// When it is smaller than maxProcess the pool grows and shrinks between the two according to its load.
+func WithMinProcess(n int) PoolOption {
+	return func(lp *ListPool) {
+		if n < 1 {
+			n = 1
+		}
+		if n > lp.maxProcess {
+			n = lp.maxProcess
+		}
+		lp.minProcess = n
+	}
+}
+
+// WithScalingPolicy 设置协程池的自动缩放策略，默认为NewThresholdPolicy。
+// 策略只能在WithMinProcess和maxProcess之间调整协程数，没有用WithMinProcess设置更小的值时协程数固定为maxProcess，NewPool会输出一条警告。
+// WithScalingPolicy sets the auto-scaling policy of the pool, NewThresholdPolicy is used by default.
+// A policy only moves the goroutine count between WithMinProcess and maxProcess, without a smaller WithMinProcess the count stays at maxProcess and NewPool logs a warning.
+func WithScalingPolicy(p ScalingPolicy) PoolOption {
+	return func(lp *ListPool) {
+		if p != nil {
+			lp.scalingPolicy = p
+			lp.scalingSet = true
+		}
+	}
+}
+
+// PanicHandler 处理没有设置onError的任务的panic，在工作协程中调用，不能再panic
+// PanicHandler handles panics of tasks without onError, it runs on the worker goroutine and must not panic itself.
+type PanicHandler func(t TaskInfo, err *PanicError)
+
+// WithPanicHandler 设置协程池的PanicHandler
+// WithPanicHandler sets the PanicHandler of the pool.
+func WithPanicHandler(h PanicHandler) PoolOption {
+	return func(lp *ListPool) {
+		lp.panicHandler = h
+	}
+}
+
+// WithName 设置协程池的名称，在Stats和MetricsHandler中用于区分同一进程中的多个协程池
+// WithName names the pool, Stats and MetricsHandler use it to tell several pools in one process apart.
+func WithName(name string) PoolOption {
+	return func(lp *ListPool) {
+		lp.name = name
+	}
+}
+
+// WithPriorityAging 设置任务每排队多久优先级相当于提高1，默认为PriorityAging，d<=0时不提高
+// WithPriorityAging sets how long a task waits to gain one priority level, PriorityAging by default, d<=0 disables aging.
+func WithPriorityAging(d time.Duration) PoolOption {
+	return func(lp *ListPool) {
+		if d < 0 {
+			d = 0
+		}
+		lp.aging = d
+	}
+}
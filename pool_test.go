@@ -0,0 +1,117 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestScaleDownLosesNoTask 在不断增减协程的同时提交任务，每个任务都执行且只执行一次
+// TestScaleDownLosesNoTask submits tasks while goroutines keep starting and retiring, every task runs exactly once.
+func TestScaleDownLosesNoTask(t *testing.T) {
+	lp := NewPool(6, 4, WithMinProcess(2))
+	defer lp.Close()
+	const n = 3000
+	runs := make([]int32, n)
+	stop := make(chan struct{})
+	var churn sync.WaitGroup
+	churn.Add(1)
+	go func() {
+		defer churn.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			lp.mutex.Lock()
+			if lp.workers > 2 {
+				lp.retire()
+			} else {
+				lp.startWorker()
+				lp.startWorker()
+			}
+			lp.mutex.Unlock()
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+	tg := lp.NewTaskGroup(n)
+	for i := 0; i < n; i++ {
+		i := i
+		err := lp.AddTask(tg.NewTaskOptions().SetAutoDone().SetPriority(rand.Intn(3)).SetTask(func() error {
+			time.Sleep(time.Duration(rand.Intn(50)) * time.Microsecond)
+			atomic.AddInt32(&runs[i], 1)
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tg.Wait()
+	close(stop)
+	churn.Wait()
+	for i, r := range runs {
+		if r != 1 {
+			t.Fatalf("task %d ran %d times", i, r)
+		}
+	}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.pending != 0 || lp.running != 0 {
+		t.Fatalf("pending %d running %d after all tasks finished", lp.pending, lp.running)
+	}
+	for w, o := range lp.outstanding {
+		if o != 0 {
+			t.Fatalf("goroutine %d still counts %d tasks", w, o)
+		}
+	}
+}
+
+// TestExecTimeout 超过SetExecTimeout的任务以ErrExecTimeout结束，不理会ctx的任务也不会一直占用协程
+// TestExecTimeout ends tasks running past SetExecTimeout with ErrExecTimeout, a task ignoring its ctx does not hold the goroutine either.
+func TestExecTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name   string
+		task   func(ctx context.Context) error
+		want   error
+		panics bool
+	}{
+		{"in time", func(ctx context.Context) error { return nil }, nil, false},
+		{"own error", func(ctx context.Context) error { return errBoom }, errBoom, false},
+		{"honours ctx", func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }, ErrExecTimeout, false},
+		{"ignores ctx", func(ctx context.Context) error { <-hang; return nil }, ErrExecTimeout, false},
+		{"panics", func(ctx context.Context) error { panic("boom") }, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp := NewPool(1, 1)
+			defer lp.Close()
+			errc := make(chan error, 1)
+			start := time.Now()
+			lp.AddTask(new(TaskOptions).SetExecTimeout(20 * time.Millisecond).SetTaskContext(tt.task).
+				SetOnSuccess(func() { errc <- nil }).
+				SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { errc <- err }))
+			err := <-errc
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("task ended after %v", elapsed)
+			}
+			var pe *PanicError
+			if tt.panics {
+				if !errors.As(err, &pe) {
+					t.Fatalf("err %v, want a PanicError", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package litepool
+
+import (
+	"math/rand"
+	"time"
+)
+
+// OverlapPolicy 决定上一次执行还没有结束时周期任务如何处理新的一次执行
+// OverlapPolicy decides what a recurring task does when its previous run is still active.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip 跳过这一次执行，默认的策略
+	// OverlapSkip skips this run, the default policy.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue 等上一次执行结束后立即执行，最多排队一次
+	// OverlapQueue runs as soon as the previous run ends, at most one run is queued.
+	OverlapQueue
+	// OverlapConcurrent 不等待上一次执行，直接提交
+	// OverlapConcurrent submits without waiting for the previous run.
+	OverlapConcurrent
+)
+
+// RecurringOption 用于在AddRecurring时配置周期任务
+// RecurringOption configures a recurring task in AddRecurring.
+type RecurringOption func(*Recurring)
+
+// WithJitter 每次执行的时间随机推迟[0, d)，避免多个周期任务同时执行
+// WithJitter delays every run by a random duration in [0, d), so recurring tasks do not all run at once.
+func WithJitter(d time.Duration) RecurringOption {
+	return func(r *Recurring) {
+		r.jitter = d
+	}
+}
+
+// WithOverlap 设置上一次执行还没有结束时的处理方式，默认为OverlapSkip
+// WithOverlap sets what happens when the previous run is still active, OverlapSkip by default.
+func WithOverlap(p OverlapPolicy) RecurringOption {
+	return func(r *Recurring) {
+		r.overlap = p
+	}
+}
+
+// Recurring 是AddRecurring返回的句柄，用于暂停、恢复或删除周期任务。
+// 它的状态由lp.mutex保护。
+// Recurring is the handle returned by AddRecurring, used to pause, resume or remove the recurring task.
+// Its state is guarded by lp.mutex.
+type Recurring struct {
+	lp  *ListPool
+	opt *TaskOptions // 每次执行时复制一份
+	// Copied for every run.
+	sched   schedule
+	jitter  time.Duration
+	overlap OverlapPolicy
+	due     time.Time // 下一次执行没有加上抖动的时间，再下一次从它开始计算
+	// Unjittered time of the next run, the run after it is computed from this.
+	timer *DelayedTask // 下一次执行的计时器，暂停或删除后为nil
+	// Timer of the next run, nil once paused or removed.
+	active int // 正在排队或执行的次数
+	// Runs being queued or executed.
+	queued bool // OverlapQueue时是否有一次执行在等待
+	// Whether a run waits under OverlapQueue.
+	paused  bool
+	removed bool
+}
+
+// AddRecurring 按照spec周期性地将opt的副本交给协程池，直到删除或者协程池关闭。
+// spec可以是"@every 30s"或"30s"这样的间隔，也可以是"*/5 * * * *"这样的5段cron表达式或@hourly、@daily等简写，
+// 无效的spec返回ErrInvalidSpec。每次执行都使用opt的副本，因此不要使用任务组的TaskOptions或SetAutoDone。
+// AddRecurring hands a copy of opt to the pool periodically according to spec, until it is removed or the pool closes.
+// spec is an interval such as "@every 30s" or "30s", a 5-field cron expression such as "*/5 * * * *", or a shorthand like @hourly or @daily,
+// an invalid spec returns ErrInvalidSpec. Every run uses a copy of opt, so do not use TaskOptions of a task group or SetAutoDone.
+func (lp *ListPool) AddRecurring(spec string, opt *TaskOptions, opts ...RecurringOption) (*Recurring, error) {
+	if err := lp.check(opt); err != nil {
+		return nil, err
+	}
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recurring{lp: lp, opt: opt, sched: sched}
+	for _, o := range opts {
+		o(r)
+	}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.close {
+		return nil, ErrPoolClosed
+	}
+	r.schedule(time.Now())
+	return r, nil
+}
+
+// Next 返回下一次执行的时间，暂停、删除或者协程池关闭后返回零值
+// Next returns the time of the next run, the zero time once paused, removed or the pool has closed.
+func (r *Recurring) Next() time.Time {
+	r.lp.mutex.Lock()
+	defer r.lp.mutex.Unlock()
+	if r.timer == nil || r.timer.index < 0 {
+		return time.Time{}
+	}
+	return r.timer.at
+}
+
+// Pause 暂停周期任务，已经提交的执行不受影响
+// Pause stops scheduling new runs, runs already submitted are not affected.
+func (r *Recurring) Pause() {
+	r.lp.mutex.Lock()
+	defer r.lp.mutex.Unlock()
+	r.paused = true
+	r.stop()
+}
+
+// Resume 恢复暂停的周期任务，从现在开始计算下一次执行的时间
+// Resume continues a paused recurring task, the next run is computed from now.
+func (r *Recurring) Resume() {
+	lp := r.lp
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if !r.paused || r.removed || lp.close {
+		return
+	}
+	r.paused = false
+	r.schedule(time.Now())
+}
+
+// Remove 删除周期任务，已经提交的执行不受影响
+// Remove deletes the recurring task, runs already submitted are not affected.
+func (r *Recurring) Remove() {
+	r.lp.mutex.Lock()
+	defer r.lp.mutex.Unlock()
+	r.removed = true
+	r.stop()
+}
+
+// schedule 安排from之后的下一次执行，调用时需持有lp.mutex。
+// 抖动只加在计时器上，再下一次执行从没有抖动的时间计算，因此抖动不会累积。
+// schedule arranges the next run after from, lp.mutex must be held.
+// Jitter only delays the timer and the run after is computed from the unjittered time, so jitter does not accumulate.
+func (r *Recurring) schedule(from time.Time) {
+	at := r.sched.next(from)
+	if now := time.Now(); !at.IsZero() && at.Before(now) {
+		// 计时器严重推迟时错过的执行不再补上
+		// Runs missed because the timer was held up badly are not made up
+		at = r.sched.next(now)
+	}
+	if at.IsZero() {
+		r.timer = nil
+		return
+	}
+	r.due = at
+	if r.jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(r.jitter))))
+	}
+	r.timer = &DelayedTask{lp: r.lp, at: at, rec: r}
+	r.lp.addTimer(r.timer)
+}
+
+// stop 取消下一次执行和排队中的执行，调用时需持有lp.mutex
+// stop cancels the next run and the queued one, lp.mutex must be held.
+func (r *Recurring) stop() {
+	r.queued = false
+	if r.timer != nil && r.timer.index >= 0 {
+		r.lp.removeTimer(r.timer)
+	}
+	r.timer = nil
+}
+
+// fire 由计时协程在到期时调用，按照重叠策略执行并安排下一次执行，调用时需持有lp.mutex
+// fire is called by the timer goroutine when due, it runs according to the overlap policy and arranges the next run, lp.mutex must be held.
+func (r *Recurring) fire() {
+	r.schedule(r.due)
+	switch {
+	case r.active == 0 || r.overlap == OverlapConcurrent:
+		r.run()
+	case r.overlap == OverlapQueue:
+		r.queued = true
+	}
+}
+
+// run 提交opt的副本，调用时需持有lp.mutex
+// run submits a copy of opt, lp.mutex must be held.
+func (r *Recurring) run() {
+	lp := r.lp
+	r.active++
+	c := r.opt.clone()
+	c.setOnEnd(func(error) {
+		// end可能在持有lp.mutex时被调用
+		// end may be called with lp.mutex held
+		go r.finished()
+	})
+	lp.firing.Add(1)
+	go lp.fire(c)
+}
+
+// finished 在一次执行结束后调用，OverlapQueue时执行排队中的一次
+// finished is called after a run ends, starting the queued run under OverlapQueue.
+func (r *Recurring) finished() {
+	lp := r.lp
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	r.active--
+	if r.queued && r.active == 0 && !lp.close {
+		r.queued = false
+		r.run()
+	}
+}
@@ -0,0 +1,46 @@
+package litepool
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRecurringJitter 抖动只推迟计时器，下一次执行仍然从没有抖动的时间计算
+// TestRecurringJitter only delays the timer with jitter, the next run is still computed from the unjittered time.
+func TestRecurringJitter(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	r := &Recurring{lp: lp, sched: intervalSchedule{every: time.Hour}, jitter: 30 * time.Minute}
+	start := time.Now()
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	r.schedule(start)
+	for i := 1; i <= 10; i++ {
+		due := start.Add(time.Duration(i) * time.Hour)
+		if !r.due.Equal(due) {
+			t.Fatalf("run %d due at %v, want %v", i, r.due, due)
+		}
+		if r.timer.at.Before(due) || !r.timer.at.Before(due.Add(r.jitter)) {
+			t.Fatalf("run %d fires at %v, want within the jitter after %v", i, r.timer.at, due)
+		}
+		lp.removeTimer(r.timer)
+		r.schedule(r.due)
+	}
+	r.stop()
+}
+
+// TestRecurringMissedRuns 计时器推迟太久时错过的执行不再补上
+// TestRecurringMissedRuns does not make up runs missed while the timer was held up.
+func TestRecurringMissedRuns(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	r := &Recurring{lp: lp, sched: intervalSchedule{every: time.Hour}}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	now := time.Now()
+	r.schedule(now.Add(-5 * time.Hour))
+	if !r.due.After(now) || r.due.After(now.Add(time.Hour+time.Second)) {
+		t.Fatalf("next run due at %v, want within an hour of %v", r.due, now)
+	}
+	r.stop()
+}
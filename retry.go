@@ -0,0 +1,217 @@
+package litepool
+
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 描述任务失败后的重试方式。每次重试在等待之后重新交给协程池，可能由任意协程执行，等待期间不占用协程。
+// RetryPolicy describes how a failed task is retried. Every retry is handed back to the pool after its wait and may run on any goroutine, no goroutine is held while waiting.
+type RetryPolicy struct {
+	MaxAttempts int // 最多执行的次数，包括第一次，<1表示不限制
+	// Maximum number of runs including the first one, <1 means no limit.
+	InitialBackoff time.Duration // 第一次重试前的等待时间
+	// Wait before the first retry.
+	MaxBackoff time.Duration // 等待时间的上限，为0时不限制
+	// Upper bound of the wait, zero means no bound.
+	Multiplier float64 // 每次重试后等待时间的倍数，<1时按1计算
+	// Factor applied to the wait after every retry, values below 1 count as 1.
+	Jitter float64 // 等待时间随机浮动的比例，0.2表示上下浮动20%
+	// Fraction by which the wait varies at random, 0.2 means up to 20% either way.
+	MaxElapsed time.Duration // 从第一次提交起不再重试的时间，为0时不限制
+	// No retry starts later than this after the first submission, zero means no limit.
+}
+
+// DefaultRetryPolicy 返回默认的重试方式：最多执行RetryAttempts次，从RetryBackoff开始翻倍等待，最长RetryMaxBackoff，上下浮动20%
+// DefaultRetryPolicy returns the default retry policy: up to RetryAttempts runs, waiting from RetryBackoff doubling up to RetryMaxBackoff, varying by 20%.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    RetryAttempts,
+		InitialBackoff: RetryBackoff,
+		MaxBackoff:     RetryMaxBackoff,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// ErrorClassifier 返回错误的类别，返回空字符串表示交给下一个分类方式
+// ErrorClassifier returns the class of an error, the empty string leaves it to the next classifier.
+type ErrorClassifier func(err error) ErrorClass
+
+// SetRetryPolicy 设置任务失败或panic后的重试方式，重试用完之前不会调用onError、onComplete等回调。
+// SetRetryPolicyFor为某个类别设置的重试方式优先，ClassPermanent的错误不会重试。
+// SetRetryPolicy sets how the task is retried after an error or a panic, callbacks such as onError and onComplete are not called until the retries run out.
+// Policies set for a class with SetRetryPolicyFor come first, and ClassPermanent errors are never retried.
+func (t *TaskOptions) SetRetryPolicy(p RetryPolicy) *TaskOptions {
+	t.retry = &p
+	return t
+}
+
+// SetRetryPolicyFor 设置类别为class的错误的重试方式，MaxAttempts为1表示这类错误不重试
+// SetRetryPolicyFor sets the retry policy for errors of class, a MaxAttempts of 1 means they are not retried.
+func (t *TaskOptions) SetRetryPolicyFor(class ErrorClass, p RetryPolicy) *TaskOptions {
+	t.classRetry = withClassPolicy(t.classRetry, class, p)
+	return t
+}
+
+// SetErrorClassifier 设置任务的错误分类方式，在Classify标记的类别之后、协程池的分类方式之前使用
+// SetErrorClassifier sets the error classifier of the task, used after the class marked with Classify and before the pool's classifier.
+func (t *TaskOptions) SetErrorClassifier(c ErrorClassifier) *TaskOptions {
+	t.classifier = c
+	return t
+}
+
+// WithErrorClassifier 设置协程池的错误分类方式，用于任务没有给出类别的错误
+// WithErrorClassifier sets the error classifier of the pool, used for errors the task does not classify.
+func WithErrorClassifier(c ErrorClassifier) PoolOption {
+	return func(lp *ListPool) {
+		lp.classifier = c
+	}
+}
+
+// WithRetryPolicyFor 为协程池中所有任务设置类别为class的错误的重试方式，任务自己的重试方式优先，
+// class为空字符串时用于没有分类的错误
+// WithRetryPolicyFor sets the retry policy for errors of class for every task of the pool, the task's own policies come first,
+// an empty class covers unclassified errors.
+func WithRetryPolicyFor(class ErrorClass, p RetryPolicy) PoolOption {
+	return func(lp *ListPool) {
+		lp.classRetry = withClassPolicy(lp.classRetry, class, p)
+	}
+}
+
+// withClassPolicy 返回加入了class的重试方式的新map，已经交给其他任务的map不会被修改
+// withClassPolicy returns a new map with the policy for class added, maps already shared with other tasks stay untouched.
+func withClassPolicy(m map[ErrorClass]*RetryPolicy, class ErrorClass, p RetryPolicy) map[ErrorClass]*RetryPolicy {
+	c := make(map[ErrorClass]*RetryPolicy, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	c[class] = &p
+	return c
+}
+
+// classify 依次按照Classify的标记、任务的分类方式和协程池的分类方式得到错误的类别
+// classify finds the class of an error from the Classify mark, the task's classifier and the pool's classifier in turn.
+func (lp *ListPool) classify(f *TaskOptions, err error) ErrorClass {
+	if c := ClassOf(err); c != "" {
+		return c
+	}
+	if f.classifier != nil {
+		if c := f.classifier(err); c != "" {
+			return c
+		}
+	}
+	if lp.classifier != nil {
+		return lp.classifier(err)
+	}
+	return ""
+}
+
+// retryPolicy 返回类别为class的错误使用的重试方式，nil表示不重试。
+// 顺序为ErrReload、任务的类别重试方式、任务的重试方式、协程池的类别重试方式，ClassRetryable最后使用DefaultRetryPolicy。
+// retryPolicy returns the policy used for an error of class, nil means no retry.
+// ErrReload comes first, then the task's policy for the class, the task's policy and the pool's policy for the class, with DefaultRetryPolicy last for ClassRetryable.
+func (lp *ListPool) retryPolicy(f *TaskOptions, class ErrorClass) *RetryPolicy {
+	if class == ClassPermanent {
+		return nil
+	}
+	if f.reload != nil {
+		return f.reload
+	}
+	if p, ok := f.classRetry[class]; ok {
+		return p
+	}
+	if f.retry != nil {
+		return f.retry
+	}
+	if p, ok := lp.classRetry[class]; ok {
+		return p
+	}
+	if class == ClassRetryable {
+		p := DefaultRetryPolicy()
+		return &p
+	}
+	return nil
+}
+
+// backoff 返回第attempt次重试前的等待时间，attempt从1开始
+// backoff returns the wait before retry number attempt, counting from 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	for i := 1; i < attempt; i++ {
+		d *= mult
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// retryLater 按照错误类别对应的重试方式在等待之后重新提交任务，返回false表示不再重试
+// retryLater resubmits the task after a wait according to the retry policy of the error's class, false means it is not retried.
+func (lp *ListPool) retryLater(n int64, f *TaskOptions, err error) bool {
+	class := lp.classify(f, err)
+	p := lp.retryPolicy(f, class)
+	if p == nil {
+		return false
+	}
+	attempt := f.attempt + 1
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return false
+	}
+	wait := p.backoff(attempt)
+	if p.MaxElapsed > 0 && time.Since(f.firstSubmitted)+wait > p.MaxElapsed {
+		return false
+	}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.close {
+		return false
+	}
+	f.attempt = attempt
+	f.retrying = true
+	lp.log(slog.LevelInfo, "task retry", n, f, slog.Int("attempt", attempt), slog.Duration("backoff", wait),
+		slog.String("class", string(class)), slog.Any("error", err))
+	lp.emitRetry(n, f, attempt, err)
+	dt := &DelayedTask{lp: lp, opt: f, at: time.Now().Add(wait)}
+	if f.key != "" {
+		// 有键的任务在等待重试时保留空位，排在后面的同键任务之后要接过它，否则其他提交可能占满空位，重试和这些任务永远等不到
+		// A keyed task keeps its slot while waiting, the tasks queued behind it take it over later, and other submissions could otherwise take every slot so that neither the retry nor they ever get one
+		dt.held = true
+	} else {
+		// 等待中的重试与延迟任务一样计入Pending，关闭时被放弃
+		// A waiting retry counts towards Pending like a delayed task and is abandoned on close
+		lp.delayed++
+	}
+	lp.addTimer(dt)
+	return true
+}
+
+// dropRetry 结束一个没能再次执行的重试，与最后一次执行失败一样调用回调并交给死信队列，err为没能执行的原因。
+// held时随后把键交给下一个任务并归还空位，调用时不能持有lp.mutex
+// dropRetry ends a retry that could not run again the way a failed last run ends, with the callbacks and the dead-letter sink, err telling why it did not run.
+// A held task then passes its key on and gives back its slot, lp.mutex must not be held.
+func (lp *ListPool) dropRetry(f *TaskOptions, held bool, err error) {
+	lp.log(slog.LevelWarn, "task retry dropped", -1, f, slog.Int("attempt", f.attempt), slog.Any("error", err))
+	lp.conclude(-1, f, err, nil)
+	if !held {
+		return
+	}
+	lp.mutex.Lock()
+	lp.releaseKey(-1, f)
+	lp.mutex.Unlock()
+}
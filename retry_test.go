@@ -0,0 +1,269 @@
+package litepool
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetryPolicyBackoff 检查等待时间的指数增长、上限和小于1的倍数
+// TestRetryPolicyBackoff checks the exponential growth of the wait, its upper bound and multipliers below 1.
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{"doubling", RetryPolicy{InitialBackoff: time.Second, Multiplier: 2},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{"capped", RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}},
+		{"initial above the cap", RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: time.Second, Multiplier: 2},
+			[]time.Duration{time.Second, time.Second}},
+		{"fractional multiplier", RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 1.5},
+			[]time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 225 * time.Millisecond}},
+		{"multiplier below 1 counts as 1", RetryPolicy{InitialBackoff: time.Second, Multiplier: 0.5},
+			[]time.Duration{time.Second, time.Second, time.Second}},
+		{"no multiplier", RetryPolicy{InitialBackoff: time.Second},
+			[]time.Duration{time.Second, time.Second}},
+		{"no backoff", RetryPolicy{Multiplier: 2}, []time.Duration{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.policy.backoff(i + 1); got != want {
+					t.Fatalf("backoff(%d) = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+	// 抖动在等待时间上下Jitter的比例内，且不会全部相同
+	// Jitter keeps the wait within the fraction either way and does not give the same wait every time
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 2 * time.Second, Multiplier: 2, Jitter: 0.5}
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		d := p.backoff(3)
+		if d < time.Second || d > 3*time.Second {
+			t.Fatalf("jittered backoff %v outside [1s, 3s]", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("jitter does not vary the backoff")
+	}
+}
+
+// TestRetryPolicy 重试在等待之后重新进入协程池，等待期间协程可以执行其他任务，用完重试后才调用onError
+// TestRetryPolicy puts retries back into the pool after their wait, the goroutine runs other tasks meanwhile and onError is only called once the retries run out.
+func TestRetryPolicy(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	var runs int32
+	failed := make(chan *ErrHandle, 1)
+	errBusy := errors.New("busy")
+	start := time.Now()
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		atomic.AddInt32(&runs, 1)
+		return errBusy
+	}).SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: 40 * time.Millisecond, Multiplier: 2}).
+		SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { failed <- h }))
+
+	// 唯一的协程在第一次重试等待时执行了另一个任务
+	// The only goroutine runs another task while the first retry waits
+	time.Sleep(10 * time.Millisecond)
+	other := make(chan struct{})
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		close(other)
+		return nil
+	}))
+	select {
+	case <-other:
+	case <-time.After(25 * time.Millisecond):
+		t.Fatal("goroutine held while the retry waits")
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("%d runs before the first backoff ended, want 1", n)
+	}
+
+	h := <-failed
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond {
+		t.Fatalf("three runs took %v, want at least 40ms+80ms of backoff", elapsed)
+	}
+	if n := atomic.LoadInt32(&runs); n != 3 || h.Attempt() != 3 || h.LastErr() != errBusy {
+		t.Fatalf("runs %d attempt %d last error %v", n, h.Attempt(), h.LastErr())
+	}
+	if s := lp.Stats(); s.Failures != 3 || s.Delayed != 0 {
+		t.Fatalf("failures %d delayed %d", s.Failures, s.Delayed)
+	}
+}
+
+// TestRetryPolicyMaxElapsed 超过MaxElapsed的重试不再进行
+// TestRetryPolicyMaxElapsed does not start a retry past MaxElapsed.
+func TestRetryPolicyMaxElapsed(t *testing.T) {
+	lp := NewPool(1, 1)
+	defer lp.Close()
+	var runs int32
+	failed := make(chan struct{})
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("down")
+	}).SetRetryPolicy(RetryPolicy{InitialBackoff: 30 * time.Millisecond, MaxElapsed: 100 * time.Millisecond}).
+		SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { close(failed) }))
+	<-failed
+	// 第四次执行会在约90ms开始，第五次会超过100ms
+	// The fourth run starts at about 90ms, a fifth would pass 100ms
+	if n := atomic.LoadInt32(&runs); n < 3 || n > 4 {
+		t.Fatalf("%d runs, want 3 or 4", n)
+	}
+}
+
+// TestClassify 按照Classify的标记、任务的分类方式、协程池的分类方式的顺序得到错误的类别
+// TestClassify finds the class from the Classify mark, the task's classifier and the pool's classifier in that order.
+func TestClassify(t *testing.T) {
+	errNet, errInput := errors.New("connection reset"), errors.New("bad input")
+	byError := func(err error, class ErrorClass) ErrorClassifier {
+		return func(e error) ErrorClass {
+			if errors.Is(e, err) {
+				return class
+			}
+			return ""
+		}
+	}
+	tests := []struct {
+		name string
+		task ErrorClassifier
+		pool ErrorClassifier
+		err  error
+		want ErrorClass
+	}{
+		{"unclassified", nil, nil, errNet, ""},
+		{"marked", nil, nil, Retryable(errNet), ClassRetryable},
+		{"marked and wrapped", nil, nil, fmt.Errorf("dial: %w", Permanent(errNet)), ClassPermanent},
+		{"marked inside a panic", nil, nil, &PanicError{Value: Classify(errNet, "network")}, "network"},
+		{"mark before classifiers", byError(errNet, "task"), byError(errNet, "pool"), Permanent(errNet), ClassPermanent},
+		{"task classifier", byError(errNet, "network"), byError(errNet, "pool"), errNet, "network"},
+		{"task classifier passes", byError(errNet, "network"), byError(errInput, ClassPermanent), errInput, ClassPermanent},
+		{"pool classifier", nil, byError(errNet, "network"), errNet, "network"},
+		{"nobody knows it", byError(errNet, "network"), byError(errNet, "network"), errInput, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp := &ListPool{classifier: tt.pool}
+			f := new(TaskOptions).SetErrorClassifier(tt.task)
+			if got := lp.classify(f, tt.err); got != tt.want {
+				t.Fatalf("classify(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+	if Classify(nil, ClassPermanent) != nil || Retryable(nil) != nil {
+		t.Fatal("a nil error was marked")
+	}
+	if err := Permanent(errInput); !errors.Is(err, errInput) || err.Error() != errInput.Error() {
+		t.Fatalf("marked error %v does not wrap %v", err, errInput)
+	}
+}
+
+// TestRetryPolicyFor 检查选择重试方式的顺序，每个重试方式用MaxAttempts区分
+// TestRetryPolicyFor checks the order in which retry policies are picked, each policy told apart by its MaxAttempts.
+func TestRetryPolicyFor(t *testing.T) {
+	policy := func(n int) RetryPolicy { return RetryPolicy{MaxAttempts: n} }
+	lp := &ListPool{}
+	WithRetryPolicyFor("network", policy(1))(lp)
+	WithRetryPolicyFor("", policy(2))(lp)
+	tests := []struct {
+		name  string
+		task  func(*TaskOptions)
+		class ErrorClass
+		want  int // 0表示不重试
+		// 0 means no retry
+	}{
+		{"none", nil, "disk", 0},
+		{"pool class", nil, "network", 1},
+		{"pool unclassified", nil, "", 2},
+		{"retryable by default", nil, ClassRetryable, DefaultRetryPolicy().MaxAttempts},
+		{"permanent", func(f *TaskOptions) { f.SetRetryPolicy(policy(3)) }, ClassPermanent, 0},
+		{"task policy before pool class", func(f *TaskOptions) { f.SetRetryPolicy(policy(3)) }, "network", 3},
+		{"task policy before the default", func(f *TaskOptions) { f.SetRetryPolicy(policy(3)) }, ClassRetryable, 3},
+		{"task class before task policy", func(f *TaskOptions) {
+			f.SetRetryPolicy(policy(3)).SetRetryPolicyFor("network", policy(4))
+		}, "network", 4},
+		{"other task class", func(f *TaskOptions) {
+			f.SetRetryPolicyFor("disk", policy(4))
+		}, "network", 1},
+		{"reload first", func(f *TaskOptions) {
+			f.SetRetryPolicyFor("network", policy(4))
+			f.reload = &RetryPolicy{MaxAttempts: 5}
+		}, "network", 5},
+		{"reload not for permanent", func(f *TaskOptions) { f.reload = &RetryPolicy{MaxAttempts: 5} }, ClassPermanent, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := new(TaskOptions)
+			if tt.task != nil {
+				tt.task(f)
+			}
+			p := lp.retryPolicy(f, tt.class)
+			if tt.want == 0 {
+				if p != nil {
+					t.Fatalf("retried with %+v", *p)
+				}
+				return
+			}
+			if p == nil || p.MaxAttempts != tt.want {
+				t.Fatalf("policy %+v, want MaxAttempts %d", p, tt.want)
+			}
+		})
+	}
+}
+
+// TestRetryPolicyForClasses 网络错误按照类别的重试方式重试，校验错误不重试，ErrHandle中可以看到次数、最后的错误和类别
+// TestRetryPolicyForClasses retries network errors with their class policy and never validation errors, ErrHandle showing the attempt, last error and class.
+func TestRetryPolicyForClasses(t *testing.T) {
+	errNet, errInput := errors.New("connection reset"), errors.New("bad input")
+	lp := NewPool(2, 2, WithErrorClassifier(func(err error) ErrorClass {
+		if errors.Is(err, errNet) {
+			return "network"
+		}
+		if errors.Is(err, errInput) {
+			return ClassPermanent
+		}
+		return ""
+	}), WithRetryPolicyFor("network", RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond}))
+	defer lp.Close()
+	tests := []struct {
+		name  string
+		err   error
+		retry *RetryPolicy
+		runs  int32
+		class ErrorClass
+	}{
+		{"network", errNet, nil, 4, "network"},
+		{"validation", errInput, nil, 1, ClassPermanent},
+		{"validation with a task policy", errInput, &RetryPolicy{MaxAttempts: 5}, 1, ClassPermanent},
+		{"unclassified", errors.New("other"), nil, 1, ""},
+		{"marked retryable", Retryable(errors.New("other")), &RetryPolicy{MaxAttempts: 2}, 2, ClassRetryable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs int32
+			failed := make(chan *ErrHandle, 1)
+			f := new(TaskOptions).SetTask(func() error {
+				atomic.AddInt32(&runs, 1)
+				return tt.err
+			}).SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { failed <- h })
+			if tt.retry != nil {
+				f.SetRetryPolicy(*tt.retry)
+			}
+			lp.AddTask(f)
+			h := <-failed
+			if n := atomic.LoadInt32(&runs); n != tt.runs || h.Attempt() != int(tt.runs) {
+				t.Fatalf("runs %d attempt %d, want %d", n, h.Attempt(), tt.runs)
+			}
+			if h.LastErr() != tt.err || h.Class() != tt.class {
+				t.Fatalf("last error %v class %q", h.LastErr(), h.Class())
+			}
+		})
+	}
+}
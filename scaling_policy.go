@@ -0,0 +1,151 @@
+package litepool
+
+import (
+	"math"
+	"time"
+)
+
+// PoolLoad 是自动缩放检查时协程池负载的快照
+// PoolLoad is a snapshot of the pool load taken at each auto-scaling check.
+type PoolLoad struct {
+	Workers int // 正在运行并接收任务的协程数
+	// Number of running goroutines that accept tasks.
+	MinWorkers int // 保留的最少协程数
+	// Minimum number of goroutines kept.
+	MaxWorkers int // 最多协程数
+	// Maximum number of goroutines.
+	SlotsPerWorker int // 每个协程可容纳的任务数（排队+运行）
+	// Tasks each goroutine can hold, queued plus running.
+	IdleSlots int // 空闲的任务空位
+	// Free task slots.
+	QueuedJobs int // 排队和正在运行的任务数，包括任务组预留的空位
+	// Number of queued and running tasks, including slots reserved by task groups.
+	AvgExecTime time.Duration // 最近一次检查以来任务的平均执行时间，没有任务完成时沿用上一次的值
+	// Average task execution time since the last check, carried over when no task finished.
+	LastScaleUp time.Time // 最后一次增加协程的时间
+	// Last time goroutines were added.
+	LastScaleDown time.Time // 最后一次释放协程的时间
+	// Last time goroutines were released.
+	Now time.Time // 快照时间
+	// Time the snapshot was taken.
+}
+
+// ScaleDecision 是缩放策略的决定，Add和Remove同时为0表示不调整
+// ScaleDecision is the outcome of a scaling policy, zero Add and Remove means no change.
+type ScaleDecision struct {
+	Add int // 需要新增的协程数量
+	// Number of goroutines to add.
+	Remove int // 需要释放的协程数量
+	// Number of goroutines to release.
+}
+
+// ScalingPolicy 根据负载快照决定协程池的伸缩，通过WithScalingPolicy为每个协程池单独设置
+// ScalingPolicy decides how the pool grows or shrinks from a load snapshot, it is set per pool with WithScalingPolicy.
+type ScalingPolicy interface {
+	Decide(load PoolLoad) ScaleDecision
+}
+
+// ThresholdPolicy 按照负载比例伸缩，未完成任务数与总容量的比例高于AddRatio时增加协程，
+// 低于QuitRatio并且距离上次增加超过QuitCD时释放协程
+// ThresholdPolicy scales on the ratio of unfinished tasks to total capacity, adding goroutines above AddRatio
+// and releasing them below QuitRatio once QuitCD has passed since the last scale up.
+type ThresholdPolicy struct {
+	AddRatio  float64       // 开始增加协程的负载比例
+	QuitRatio float64       // 开始释放协程的负载比例
+	AddScale  float64       // 每次增加的协程数占最大协程数的比例
+	QuitScale float64       // 每次释放的协程数占当前协程数的比例
+	QuitCD    time.Duration // 增加协程后多久内不释放协程
+}
+
+// NewThresholdPolicy 返回使用const.go中默认值的ThresholdPolicy，这也是协程池默认的缩放策略
+// NewThresholdPolicy returns a ThresholdPolicy using the defaults in const.go, it is also the default policy of a pool.
+func NewThresholdPolicy() *ThresholdPolicy {
+	return &ThresholdPolicy{
+		AddRatio:  MinAutoAdd,
+		QuitRatio: MaxAutoQuit,
+		AddScale:  AutoAddScale,
+		QuitScale: AutoQuitScale,
+		QuitCD:    TaskQuitCD,
+	}
+}
+
+func (p *ThresholdPolicy) Decide(load PoolLoad) ScaleDecision {
+	if load.Workers == 0 || load.SlotsPerWorker == 0 {
+		return ScaleDecision{}
+	}
+	bl := float64(load.QueuedJobs) / float64(load.Workers*load.SlotsPerWorker) // 计算负载平衡
+	// Calculate the load balance.
+	if bl >= p.AddRatio && load.Workers < load.MaxWorkers {
+		// 当一定比例的任务正在运行时，增加协程池的大小
+		// When a certain ratio of tasks is running, increase the size of the goroutine pool.
+		return ScaleDecision{Add: atLeastOne(float64(load.MaxWorkers) * p.AddScale)}
+	}
+	if bl < p.QuitRatio && load.Workers > load.MinWorkers && load.Now.Sub(load.LastScaleUp) >= p.QuitCD {
+		// 任务较少，并且已经过了新增协程后的冷却时间
+		// Tasks are few and the cooldown after adding goroutines has passed
+		return ScaleDecision{Remove: atLeastOne(float64(load.Workers) * p.QuitScale)}
+	}
+	return ScaleDecision{}
+}
+
+// LatencyTargetPolicy 让新任务的预计排队时间保持在Target以内，
+// 预计排队时间按每个协程的未完成任务数乘以平均执行时间估算
+// LatencyTargetPolicy keeps the expected queueing time of a new task under Target,
+// estimated as unfinished tasks per goroutine times the average execution time.
+type LatencyTargetPolicy struct {
+	Target time.Duration // 期望的最长排队时间
+	// Desired maximum queueing time.
+	Cooldown time.Duration // 增加协程后多久内不释放协程
+	// How long after a scale up no goroutine is released.
+}
+
+func (p *LatencyTargetPolicy) Decide(load PoolLoad) ScaleDecision {
+	if load.Workers == 0 || p.Target <= 0 {
+		return ScaleDecision{}
+	}
+	if load.AvgExecTime <= 0 {
+		// 还没有执行时间数据，只在空位用完时增加协程
+		// No execution time yet, only grow once the slots are used up
+		if load.IdleSlots == 0 && load.Workers < load.MaxWorkers {
+			return ScaleDecision{Add: 1}
+		}
+		return ScaleDecision{}
+	}
+	work := float64(load.QueuedJobs) * float64(load.AvgExecTime)
+	wait := time.Duration(work / float64(load.Workers))
+	want := int(math.Ceil(work / float64(p.Target)))
+	if wait > p.Target && load.Workers < load.MaxWorkers {
+		return ScaleDecision{Add: max(want-load.Workers, 1)}
+	}
+	if wait < p.Target/2 && want < load.Workers && load.Workers > load.MinWorkers &&
+		load.Now.Sub(load.LastScaleUp) >= p.Cooldown {
+		// 一次只释放一个协程，避免负载波动时反复伸缩
+		// Release one goroutine at a time to avoid flapping under fluctuating load
+		return ScaleDecision{Remove: 1}
+	}
+	return ScaleDecision{}
+}
+
+// FixedSizePolicy 让协程数量保持在Size，Size会被限制在最少和最多协程数之间
+// FixedSizePolicy keeps the number of goroutines at Size, clamped between the minimum and maximum.
+type FixedSizePolicy struct {
+	Size int
+}
+
+func (p *FixedSizePolicy) Decide(load PoolLoad) ScaleDecision {
+	size := min(max(p.Size, load.MinWorkers), load.MaxWorkers)
+	if size > load.Workers {
+		return ScaleDecision{Add: size - load.Workers}
+	}
+	if size < load.Workers {
+		return ScaleDecision{Remove: load.Workers - size}
+	}
+	return ScaleDecision{}
+}
+
+func atLeastOne(f float64) int {
+	if n := int(f); n > 0 {
+		return n
+	}
+	return 1
+}
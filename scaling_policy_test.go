@@ -0,0 +1,113 @@
+package litepool
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestScalingPolicyDecide 检查内置缩放策略在各种负载下的决定
+// TestScalingPolicyDecide checks the decisions of the built-in scaling policies under various loads.
+func TestScalingPolicyDecide(t *testing.T) {
+	now := time.Now()
+	threshold := &ThresholdPolicy{AddRatio: 0.7, QuitRatio: 0.3, AddScale: 0.25, QuitScale: 0.5, QuitCD: 10 * time.Second}
+	latency := &LatencyTargetPolicy{Target: 10 * time.Millisecond, Cooldown: time.Second}
+	tests := []struct {
+		name   string
+		policy ScalingPolicy
+		load   PoolLoad
+		want   ScaleDecision
+	}{
+		{"threshold/no workers", threshold,
+			PoolLoad{MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 4, Now: now}, ScaleDecision{}},
+		{"threshold/high load", threshold,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 6, Now: now}, ScaleDecision{Add: 2}},
+		{"threshold/high load at max", threshold,
+			PoolLoad{Workers: 8, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 16, Now: now}, ScaleDecision{}},
+		{"threshold/adds at least one", threshold,
+			PoolLoad{Workers: 1, MinWorkers: 1, MaxWorkers: 2, SlotsPerWorker: 2, QueuedJobs: 2, Now: now}, ScaleDecision{Add: 1}},
+		{"threshold/medium load", threshold,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 4, Now: now}, ScaleDecision{}},
+		{"threshold/low load in cooldown", threshold,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 1, LastScaleUp: now.Add(-5 * time.Second), Now: now}, ScaleDecision{}},
+		{"threshold/low load", threshold,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 1, LastScaleUp: now.Add(-20 * time.Second), Now: now}, ScaleDecision{Remove: 2}},
+		{"threshold/low load at min", threshold,
+			PoolLoad{Workers: 2, MinWorkers: 2, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 0, Now: now}, ScaleDecision{}},
+		{"threshold/removes at least one", threshold,
+			PoolLoad{Workers: 3, MinWorkers: 1, MaxWorkers: 8, SlotsPerWorker: 2, QueuedJobs: 0, Now: now}, ScaleDecision{Remove: 1}},
+
+		{"latency/no exec time with free slots", latency,
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, IdleSlots: 1, QueuedJobs: 5, Now: now}, ScaleDecision{}},
+		{"latency/no exec time and full", latency,
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 6, Now: now}, ScaleDecision{Add: 1}},
+		{"latency/over target", latency,
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 6, AvgExecTime: 10 * time.Millisecond, Now: now}, ScaleDecision{Add: 4}},
+		{"latency/slightly over target", latency,
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 3, AvgExecTime: 10 * time.Millisecond, Now: now}, ScaleDecision{Add: 1}},
+		{"latency/over target at max", latency,
+			PoolLoad{Workers: 8, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 80, AvgExecTime: 10 * time.Millisecond, Now: now}, ScaleDecision{}},
+		{"latency/within target", latency,
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 3, AvgExecTime: 5 * time.Millisecond, Now: now}, ScaleDecision{}},
+		{"latency/well under target", latency,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 1, AvgExecTime: time.Millisecond, Now: now}, ScaleDecision{Remove: 1}},
+		{"latency/well under target in cooldown", latency,
+			PoolLoad{Workers: 4, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 1, AvgExecTime: time.Millisecond, LastScaleUp: now, Now: now}, ScaleDecision{}},
+		{"latency/well under target at min", latency,
+			PoolLoad{Workers: 2, MinWorkers: 2, MaxWorkers: 8, AvgExecTime: time.Millisecond, Now: now}, ScaleDecision{}},
+		{"latency/no target", &LatencyTargetPolicy{},
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8, QueuedJobs: 6, Now: now}, ScaleDecision{}},
+
+		{"fixed/grow", &FixedSizePolicy{Size: 5},
+			PoolLoad{Workers: 2, MinWorkers: 1, MaxWorkers: 8}, ScaleDecision{Add: 3}},
+		{"fixed/shrink", &FixedSizePolicy{Size: 5},
+			PoolLoad{Workers: 7, MinWorkers: 1, MaxWorkers: 8}, ScaleDecision{Remove: 2}},
+		{"fixed/at size", &FixedSizePolicy{Size: 5},
+			PoolLoad{Workers: 5, MinWorkers: 1, MaxWorkers: 8}, ScaleDecision{}},
+		{"fixed/clamped to max", &FixedSizePolicy{Size: 20},
+			PoolLoad{Workers: 6, MinWorkers: 1, MaxWorkers: 8}, ScaleDecision{Add: 2}},
+		{"fixed/clamped to min", &FixedSizePolicy{},
+			PoolLoad{Workers: 4, MinWorkers: 2, MaxWorkers: 8}, ScaleDecision{Remove: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Decide(tt.load); got != tt.want {
+				t.Fatalf("Decide = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScalingPolicyWithoutMinProcess 设置了策略但没有伸缩范围时输出警告
+// TestScalingPolicyWithoutMinProcess logs a warning when a policy is set but the pool has no room to scale.
+func TestScalingPolicyWithoutMinProcess(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	lp := NewPool(4, 1, WithLogger(logger), WithScalingPolicy(&FixedSizePolicy{Size: 2}))
+	lp.Close()
+	if !strings.Contains(buf.String(), "scaling policy has no effect") {
+		t.Fatalf("no warning logged: %s", buf.String())
+	}
+}
+
+// TestFixedSizePolicy 设置WithMinProcess后FixedSizePolicy把协程数调整到Size
+// TestFixedSizePolicy brings the goroutine count to Size once WithMinProcess leaves room to scale.
+func TestFixedSizePolicy(t *testing.T) {
+	lp := NewPool(8, 1, WithMinProcess(1), WithScalingPolicy(&FixedSizePolicy{Size: 5}))
+	defer lp.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lp.mutex.Lock()
+		workers := lp.workers
+		lp.mutex.Unlock()
+		if workers == 5 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines, want 5", workers)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
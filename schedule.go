@@ -0,0 +1,214 @@
+package litepool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule 计算周期任务的下一次执行时间
+// schedule computes the next run time of a recurring task.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+// intervalSchedule 每隔固定时间执行一次
+// intervalSchedule runs once every fixed interval.
+type intervalSchedule struct {
+	every time.Duration
+}
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(s.every)
+}
+
+// cronSchedule 是标准的5段cron表达式：分 时 日 月 周，每一段是允许的取值的位图，月和周可以使用JAN、MON这样的英文缩写
+// cronSchedule is a standard 5-field cron expression: minute hour day-of-month month day-of-week, each field is a bitmap of allowed values,
+// months and weekdays may be written as names such as JAN or MON.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周都不以*开头时，满足其中一个即可，与标准cron相同，*/2这样的步长同样以*开头
+	// When neither day-of-month nor day-of-week starts with *, matching either one is enough, as in standard cron, steps such as */2 start with * as well
+	domAny, dowAny bool
+}
+
+// cronField 描述cron表达式中一段的取值范围
+// cronField describes the value range of one field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // 从min开始的取值的英文缩写
+	// Names of the values starting from min.
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{"day of week", 0, 7, []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// value 解析一个取值，不区分大小写地接受英文缩写
+// value parses one value, accepting the names case-insensitively.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	return strconv.Atoi(s)
+}
+
+// cronDescriptors 是常用的cron表达式简写
+// cronDescriptors are shorthands for common cron expressions.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule 解析AddRecurring的spec，支持"@every 1m"、"1m"这样的间隔，5段cron表达式以及@daily等简写
+// parseSchedule parses the spec of AddRecurring: intervals such as "@every 1m" or "1m", 5-field cron expressions and shorthands such as @daily.
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if s, ok := cronDescriptors[spec]; ok {
+		spec = s
+	}
+	every := strings.TrimPrefix(spec, "@every ")
+	if d, err := time.ParseDuration(strings.TrimSpace(every)); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("%w: interval %q must be positive", ErrInvalidSpec, every)
+		}
+		return intervalSchedule{every: d}, nil
+	} else if every != spec {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("%w: %q needs 5 fields, got %d", ErrInvalidSpec, spec, len(fields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 周日可以写成0或7
+	// Sunday may be written as 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	s := &cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: %q never matches", ErrInvalidSpec, spec)
+	}
+	return s, nil
+}
+
+// parseCronField 解析一段cron表达式，支持*、数字或英文缩写、a-b范围、逗号分隔的列表和/n步长
+// parseCronField parses one cron field, supporting *, numbers or names, a-b ranges, comma separated lists and /n steps.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, step := f.min, f.max, 1
+		expr := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: bad step in %s field %q", ErrInvalidSpec, f.name, part)
+			}
+			step = n
+			expr = part[:i]
+		}
+		if expr != "*" {
+			bounds := strings.SplitN(expr, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, fmt.Errorf("%w: bad %s field %q", ErrInvalidSpec, f.name, part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, fmt.Errorf("%w: bad %s field %q", ErrInvalidSpec, f.name, part)
+				}
+			} else if step > 1 {
+				// "a/n"表示从a开始到最大值
+				// "a/n" means from a up to the maximum
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%w: %s field %q out of range %d-%d", ErrInvalidSpec, f.name, part, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// next 返回t之后第一个匹配的分钟，5年内没有匹配时返回零值。
+// 夏令时开始时跳过的时间不会执行，结束时重复的一个小时中墙上时间已经过去的分钟不会再执行一次。
+// next returns the first matching minute after t, the zero time when nothing matches within 5 years.
+// Times skipped when daylight saving starts do not run, and in the hour repeated when it ends the minutes whose wall clock time has passed do not run again.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	after := wallClock(t)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !s.matchDay(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 || !wallClock(t).After(after) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// forward 返回next，夏令时开始时time.Date会把跳过的时间调整到跳过之前，next不在t之后时按小时推到t之后
+// forward returns next, when daylight saving starts time.Date moves a skipped time back before the gap, so a next not after t is pushed past t hour by hour.
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// wallClock 返回t的墙上时间，精确到分钟，用于比较同一时区中不同偏移的时间
+// wallClock returns the wall clock time of t to the minute, used to compare times of one zone under different offsets.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
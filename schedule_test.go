@@ -0,0 +1,144 @@
+package litepool
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestParseSchedule 检查间隔、cron表达式和简写的解析，无效的spec返回ErrInvalidSpec
+// TestParseSchedule checks the parsing of intervals, cron expressions and shorthands, invalid specs return ErrInvalidSpec.
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"@every 30s", true},
+		{"30s", true},
+		{" 1m30s ", true},
+		{"@hourly", true},
+		{"@daily", true},
+		{"*/5 * * * *", true},
+		{"0 9 * * MON-FRI", true},
+		{"0 0 1 jan,Jul *", true},
+		{"0 0 * * 7", true},
+		{"0-30/10 8-18 * * *", true},
+		{"", false},
+		{"@every 0s", false},
+		{"@every -1s", false},
+		{"@every soon", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"0 0 * FOO *", false},
+		{"0 0 * * MON-FOO", false},
+		{"0 0 30 2 *", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseSchedule(tt.spec)
+			if tt.valid && err != nil {
+				t.Fatalf("parseSchedule(%q): %v", tt.spec, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSpec) {
+				t.Fatalf("parseSchedule(%q): %v, want ErrInvalidSpec", tt.spec, err)
+			}
+		})
+	}
+}
+
+// TestScheduleNext 检查跨越小时、月、年的下一次执行时间，以及日和周两段的组合方式
+// TestScheduleNext checks next run times across hours, months and years, and how the day-of-month and day-of-week fields combine.
+func TestScheduleNext(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"interval", "@every 90s", at(2024, 1, 1, 10, 0), at(2024, 1, 1, 10, 0).Add(90 * time.Second)},
+		{"step", "*/15 * * * *", at(2024, 1, 1, 10, 7), at(2024, 1, 1, 10, 15)},
+		{"strictly after", "*/15 * * * *", at(2024, 1, 1, 10, 15), at(2024, 1, 1, 10, 30)},
+		{"seconds are dropped", "*/15 * * * *", at(2024, 1, 1, 10, 14).Add(59 * time.Second), at(2024, 1, 1, 10, 15)},
+		{"next hour", "5 * * * *", at(2024, 1, 1, 10, 30), at(2024, 1, 1, 11, 5)},
+		{"weekdays over a weekend", "0 9 * * MON-FRI", at(2024, 1, 5, 10, 0), at(2024, 1, 8, 9, 0)},
+		{"first of the month", "@monthly", at(2024, 1, 31, 12, 0), at(2024, 2, 1, 0, 0)},
+		{"skips short months", "0 0 31 * *", at(2024, 2, 1, 0, 0), at(2024, 3, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", at(2024, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		{"month name", "0 0 1 JAN *", at(2024, 6, 1, 0, 0), at(2025, 1, 1, 0, 0)},
+		{"end of year", "59 23 31 12 *", at(2024, 12, 31, 23, 59), at(2025, 12, 31, 23, 59)},
+		{"sunday as 0", "0 0 * * 0", at(2024, 1, 1, 0, 0), at(2024, 1, 7, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", at(2024, 1, 1, 0, 0), at(2024, 1, 7, 0, 0)},
+		// 两段都受限制时满足其中一个即可：1月5日是周五
+		// With both fields restricted either one matches: 5 January is a Friday
+		{"day or weekday", "0 12 13 * FRI", at(2024, 1, 1, 0, 0), at(2024, 1, 5, 12, 0)},
+		{"day or weekday, day first", "0 12 13 * FRI", at(2024, 9, 7, 0, 0), at(2024, 9, 13, 12, 0)},
+		// 以*开头的步长要求两段同时满足：1月12日是偶数，1月19日是奇数
+		// A step starting with * requires both fields: 12 January is even, 19 January is odd
+		{"step day and weekday", "0 12 */2 * FRI", at(2024, 1, 6, 0, 0), at(2024, 1, 19, 12, 0)},
+		{"any day and weekday", "0 12 * * FRI", at(2024, 1, 6, 0, 0), at(2024, 1, 12, 12, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScheduleNextDST 夏令时开始时跳过不存在的时间，结束时重复的一个小时不会执行两次
+// TestScheduleNextDST skips times that do not exist when daylight saving starts and does not run twice in the hour repeated when it ends.
+func TestScheduleNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	est, edt := time.FixedZone("EST", -5*3600), time.FixedZone("EDT", -4*3600)
+	at := func(zone *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, zone).In(loc)
+	}
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// 2024-03-10 02:00 EST直接跳到03:00 EDT
+		// On 2024-03-10 02:00 EST jumps straight to 03:00 EDT
+		{"hourly over the gap", "0 * * * *", at(est, 2024, 3, 10, 1, 0), at(edt, 2024, 3, 10, 3, 0)},
+		{"time in the gap", "30 2 * * *", at(est, 2024, 3, 10, 0, 0), at(edt, 2024, 3, 11, 2, 30)},
+		{"daily over the gap", "0 9 * * *", at(est, 2024, 3, 9, 9, 0), at(edt, 2024, 3, 10, 9, 0)},
+		// 2024-11-03 02:00 EDT退回到01:00 EST，01:00到02:00出现两次
+		// On 2024-11-03 02:00 EDT goes back to 01:00 EST, 01:00 to 02:00 happens twice
+		{"time in the repeated hour", "30 1 * * *", at(edt, 2024, 11, 3, 1, 30), at(est, 2024, 11, 4, 1, 30)},
+		{"step in the repeated hour", "*/30 * * * *", at(edt, 2024, 11, 3, 1, 30), at(est, 2024, 11, 3, 2, 0)},
+		{"hourly over the repeated hour", "0 * * * *", at(edt, 2024, 11, 3, 1, 0), at(est, 2024, 11, 3, 2, 0)},
+		{"into the repeated hour", "0 * * * *", at(edt, 2024, 11, 3, 0, 30), at(edt, 2024, 11, 3, 1, 0)},
+		{"daily over the repeated hour", "0 9 * * *", at(edt, 2024, 11, 2, 9, 0), at(est, 2024, 11, 3, 9, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package litepool
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerStats 是一个协程的运行信息
+// WorkerStats holds the runtime information of one goroutine.
+type WorkerStats struct {
+	ID int64
+	// Running 协程是否正在运行，退出的协程保留之前的计数
+	// Running reports whether the goroutine is running, an exited goroutine keeps its earlier counts
+	Running bool
+	// Idle 协程正在运行并且没有排队或执行中的任务
+	// Idle means the goroutine is running and has no queued or executing task
+	Idle       bool
+	QueueDepth int // 排队中的任务数
+	// Tasks waiting in the queue.
+	Executing int // 正在执行的任务数
+	// Tasks being executed.
+	Executed int64 // 执行过的任务数
+	// Tasks executed.
+	Successes int64
+	Failures  int64 // 返回错误的任务数，包括执行超时，不包括panic
+	// Tasks that returned an error, execution timeouts included and panics excluded.
+	Panics int64
+	Stolen int64 // 从其他协程的队列中取来执行的任务数
+	// Tasks taken from the queues of other goroutines.
+	BusyTime time.Duration // 执行任务的总时间
+	// Total time spent executing tasks.
+}
+
+// Stats 是协程池某一时刻的运行信息
+// Stats is a snapshot of the runtime information of the pool.
+type Stats struct {
+	Name string // WithName设置的名称
+	// Name set with WithName.
+	Workers []WorkerStats // 按协程ID排列
+	// Ordered by goroutine ID.
+	MaxWorkers     int
+	MinWorkers     int
+	RunningWorkers int
+	IdleWorkers    int
+	IdleSlots      int // 可以立即接收任务的空位
+	// Slots that can take a task right away.
+	QueueDepth int // 所有协程排队中的任务数
+	// Tasks waiting in all queues.
+	Executing int
+	Delayed   int // 还没有到期的延迟任务数
+	// Delayed tasks that have not fired yet.
+	KeyWaiting int // 等待同一个键的前一个任务结束的任务数
+	// Tasks waiting for an earlier task of the same key to finish.
+	Executed  int64
+	Successes int64
+	Failures  int64
+	Panics    int64
+	Stolen    int64 // 空闲的协程从其他协程的队列中取来执行的任务数
+	// Tasks idle goroutines took from the queues of other goroutines.
+	SubmitTimeouts int64 // 在SetAddTimeout设置的时间内没有等到空位的提交
+	// Submissions that did not get a slot within the SetAddTimeout duration.
+	BusyTime  time.Duration
+	QueueWait Histogram // 从提交到开始执行的时间，包括等待空位的时间
+	// Time from submission to the start of execution, waiting for a slot included.
+	ExecTime Histogram // 任务的执行时间
+	// Execution time of tasks.
+}
+
+// Stats 返回协程池的运行信息，可以在任务执行时并发调用
+// Stats returns the runtime information of the pool, it is safe to call while tasks are running.
+func (lp *ListPool) Stats() Stats {
+	s := Stats{
+		Name:           lp.name,
+		Workers:        make([]WorkerStats, lp.maxProcess),
+		MaxWorkers:     lp.maxProcess,
+		MinWorkers:     lp.minProcess,
+		SubmitTimeouts: atomic.LoadInt64(&lp.submitTimeouts),
+		QueueWait:      lp.queueWait.snapshot(),
+		ExecTime:       lp.execTime.snapshot(),
+	}
+	lp.mutex.Lock()
+	for n := range s.Workers {
+		w := &s.Workers[n]
+		w.ID = int64(n)
+		w.Running = len(lp.statusWorker[n]) > 0
+		if q := lp.task[n]; q != nil {
+			w.QueueDepth = q.Len()
+		}
+		// outstanding是排队和执行中的任务数之和
+		// outstanding is the number of queued plus executing tasks
+		w.Executing = lp.outstanding[n] - w.QueueDepth
+		w.Idle = w.Running && w.QueueDepth == 0 && w.Executing == 0
+	}
+	s.Delayed = lp.delayed
+	s.KeyWaiting = lp.keyWaiting
+	s.IdleSlots = len(lp.idleRun)
+	lp.mutex.Unlock()
+
+	for n := range s.Workers {
+		w := &s.Workers[n]
+		w.Executed = atomic.LoadInt64(&lp.numCount[n])
+		w.Successes = atomic.LoadInt64(&lp.successCount[n])
+		w.Failures = atomic.LoadInt64(&lp.failCount[n])
+		w.Panics = atomic.LoadInt64(&lp.panicCount[n])
+		w.Stolen = atomic.LoadInt64(&lp.stealCount[n])
+		w.BusyTime = time.Duration(atomic.LoadInt64((*int64)(&lp.timeCount[n])))
+
+		if w.Running {
+			s.RunningWorkers++
+		}
+		if w.Idle {
+			s.IdleWorkers++
+		}
+		s.QueueDepth += w.QueueDepth
+		s.Executing += w.Executing
+		s.Executed += w.Executed
+		s.Successes += w.Successes
+		s.Failures += w.Failures
+		s.Panics += w.Panics
+		s.Stolen += w.Stolen
+		s.BusyTime += w.BusyTime
+	}
+	return s
+}
+
+// String 按照Usage的格式输出运行信息
+// String formats the snapshot the way Usage prints it.
+func (s Stats) String() string {
+	var b strings.Builder
+	for _, w := range s.Workers {
+		// 输出指定协程的正在运行的任务数
+		// Print the number of tasks that are still running for a specified goroutine
+		fmt.Fprintf(&b, "Goroutine %v, with a total of %v jobs\n", w.ID, w.QueueDepth)
+		// 输出协程的ID，执行次数，以及总执行时间
+		// Print the ID of the goroutine, the number of executions, and the total execution time
+		fmt.Fprintln(&b, "My goroutine ID is", w.ID, "I have executed tasks", w.Executed, "times", "My total execution time for tasks is:", w.BusyTime.Milliseconds(), "milliseconds")
+	}
+	fmt.Fprintf(&b, "Workers running: %v, idle: %v, tasks queued: %v, executing: %v, delayed: %v\n",
+		s.RunningWorkers, s.IdleWorkers, s.QueueDepth, s.Executing, s.Delayed)
+	fmt.Fprintf(&b, "Tasks executed: %v, succeeded: %v, failed: %v, panicked: %v, stolen: %v, submit timeouts: %v\n",
+		s.Executed, s.Successes, s.Failures, s.Panics, s.Stolen, s.SubmitTimeouts)
+	fmt.Fprintf(&b, "Queue wait p50: %v, p99: %v, execution p50: %v, p99: %v\n",
+		s.QueueWait.Percentile(50), s.QueueWait.Percentile(99), s.ExecTime.Percentile(50), s.ExecTime.Percentile(99))
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package litepool
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// WithWorkStealing 设置空闲的协程是否从其他忙碌协程的队列中取任务执行，默认开启。
+// 开启时一个协程被慢任务卡住，它队列中的其他任务仍然可以由空闲的协程执行。
+// WithWorkStealing sets whether idle goroutines take queued tasks from busy siblings, it is on by default.
+// With it on, the tasks queued behind a slow one are still picked up by idle goroutines.
+func WithWorkStealing(enabled bool) PoolOption {
+	return func(lp *ListPool) {
+		lp.stealing = enabled
+	}
+}
+
+// steal 为空闲的协程n从队列最长的忙碌协程中取出一个任务，同时转移两者的任务计数，调用时需持有lp.mutex。
+// 任务占用的空位不属于某个协程，因此idleRun不需要调整。
+// steal takes a task for idle goroutine n from the busy goroutine with the longest queue and moves the task count between them, lp.mutex must be held.
+// The slot held by the task does not belong to a goroutine, so idleRun needs no change.
+func (lp *ListPool) steal(n int64) *TaskOptions {
+	if !lp.stealing || lp.abort || !lp.accepting[n] {
+		return nil
+	}
+	victim, longest := int64(-1), 0
+	for v, q := range lp.task {
+		if int64(v) == n || q == nil || q.Len() <= longest {
+			continue
+		}
+		// 只从正在执行任务的协程中取，空闲的协程很快会自己执行
+		// Only take from goroutines that are executing, idle ones are about to run their queue themselves
+		if lp.outstanding[v] > q.Len() {
+			victim, longest = int64(v), q.Len()
+		}
+	}
+	if victim < 0 {
+		return nil
+	}
+	f := lp.task[victim].pop()
+	lp.outstanding[victim]--
+	lp.dispatcher.Update(victim, lp.outstanding[victim])
+	lp.outstanding[n]++
+	lp.dispatcher.Update(n, lp.outstanding[n])
+	atomic.AddInt64(&lp.stealCount[n], 1)
+	lp.log(slog.LevelDebug, "task stolen", n, f, slog.Int64("from", victim))
+	return f
+}
+
+// wakeIdle 在任务排到忙碌的协程n后面时唤醒一个空闲的协程来取走它，调用时需持有lp.mutex
+// wakeIdle wakes an idle goroutine to take the task queued behind busy goroutine n, lp.mutex must be held.
+func (lp *ListPool) wakeIdle(n int64) {
+	if !lp.stealing {
+		return
+	}
+	for m, ok := range lp.accepting {
+		if ok && int64(m) != n && lp.outstanding[m] == 0 {
+			lp.task[m].wake()
+			return
+		}
+	}
+}
@@ -1,27 +1,189 @@
 package litepool
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 type TaskGroup struct {
 	wg sync.WaitGroup
+	lp *ListPool
+	id uint64 // 日志中区分任务组
+	// Tells groups apart in logs.
+	// 以下字段用于NewTaskGroupContext创建的任务组
+	// The fields below are used by groups created with NewTaskGroupContext
+	parent context.Context // 提交任务时使用的上下文
+	// Context used while submitting tasks.
+	ctx context.Context // 任务组共享的上下文
+	// Context shared by the tasks of the group.
+	cancel        context.CancelCauseFunc
+	cancelOnError bool // 第一个错误发生时取消ctx
+	// Cancel ctx on the first error.
+	firstError bool // Wait只返回第一个错误
+	// Wait only returns the first error.
+	mutex sync.Mutex
+	errs  []error // 任务最终的错误
+	// Final errors of the tasks.
+	queueWait histogram // 任务组中任务从提交到开始执行的时间
+	// Time from submission to the start of execution of the group's tasks.
+	execTime histogram // 任务组中任务的执行时间
+	// Execution time of the group's tasks.
+	panics int64 // 任务组中panic的任务数
+	// Tasks of the group that panicked.
 }
 
+// GroupStats 是任务组的耗时统计
+// GroupStats holds the latency histograms of a task group.
+type GroupStats struct {
+	QueueWait Histogram // 从提交到开始执行的时间
+	// Time from submission to the start of execution.
+	ExecTime Histogram
+	Panics   int64
+}
+
+// Stats 返回任务组中已经执行的任务的耗时统计
+// Stats returns the latency histograms of the tasks of the group that have run.
+func (tg *TaskGroup) Stats() GroupStats {
+	return GroupStats{
+		QueueWait: tg.queueWait.snapshot(),
+		ExecTime:  tg.execTime.snapshot(),
+		Panics:    atomic.LoadInt64(&tg.panics),
+	}
+}
+
+// GroupOption 用于在NewTaskGroupContext时配置任务组
+// GroupOption configures a TaskGroup created by NewTaskGroupContext.
+type GroupOption func(*TaskGroup)
+
+// WithCancelOnError 第一个任务失败时取消任务组的ctx
+// WithCancelOnError cancels the group ctx when the first task fails.
+func WithCancelOnError() GroupOption {
+	return func(tg *TaskGroup) {
+		tg.cancelOnError = true
+	}
+}
+
+// WithFirstError 让Wait只返回第一个错误，默认使用errors.Join返回所有错误
+// WithFirstError makes Wait return only the first error, by default all errors are returned with errors.Join.
+func WithFirstError() GroupOption {
+	return func(tg *TaskGroup) {
+		tg.firstError = true
+	}
+}
+
+// NewTaskGroup 创建固定任务数量的任务组，每个任务需要通过SetAutoDone或Done完成
+// NewTaskGroup creates a group with a fixed number of tasks, each of them is completed by SetAutoDone or Done.
 func (lp *ListPool) NewTaskGroup(taskNum int) *TaskGroup {
-	wg := sync.WaitGroup{}
-	wg.Add(taskNum)
-	tg := &TaskGroup{wg: wg}
+	tg := &TaskGroup{lp: lp, id: atomic.AddUint64(&lp.groupID, 1)}
+	tg.wg.Add(taskNum)
 	lp.mutex.Lock()
 	lp.TaskGroupList = append(lp.TaskGroupList, tg)
 	lp.mutex.Unlock()
 	return tg
 }
 
+// NewTaskGroupContext 创建一个通过Go动态添加任务的任务组，任务结束时自动完成，不需要预先设置数量。
+// 任务收到的ctx在ctx取消、协程池关闭或者设置了WithCancelOnError并且有任务失败时取消。
+// NewTaskGroupContext creates a group whose tasks are added with Go and completed automatically, no count is needed in advance.
+// The ctx given to the tasks is cancelled when ctx is done, the pool shuts down, or a task fails with WithCancelOnError.
+func (lp *ListPool) NewTaskGroupContext(ctx context.Context, opts ...GroupOption) *TaskGroup {
+	tg := &TaskGroup{lp: lp, id: atomic.AddUint64(&lp.groupID, 1), parent: ctx}
+	tg.ctx, tg.cancel = context.WithCancelCause(ctx)
+	for _, opt := range opts {
+		opt(tg)
+	}
+	lp.mutex.Lock()
+	lp.TaskGroupList = append(lp.TaskGroupList, tg)
+	lp.mutex.Unlock()
+	return tg
+}
+
+// Context 返回任务组共享的上下文，固定数量的任务组返回context.Background()
+// Context returns the ctx shared by the group, context.Background() for fixed-count groups.
+func (tg *TaskGroup) Context() context.Context {
+	if tg.ctx == nil {
+		return context.Background()
+	}
+	return tg.ctx
+}
+
+// Go 向任务组添加一个任务并提交给协程池，提交失败时错误同样由Wait返回
+// Go adds a task to the group and submits it to the pool, a failed submission is also reported by Wait.
+func (tg *TaskGroup) Go(f func(ctx context.Context) error) {
+	tg.GoTask(tg.NewTaskOptions().SetTaskContext(f))
+}
+
+// GoTask 与Go相同，但使用由tg.NewTaskOptions创建的TaskOptions，可以设置回调和超时，SetAutoDone会被忽略
+// GoTask is like Go but takes TaskOptions created by tg.NewTaskOptions, so callbacks and timeouts can be set, SetAutoDone is ignored.
+func (tg *TaskGroup) GoTask(opt *TaskOptions) {
+	tg.wg.Add(1)
+	opt.autoDone = false
+	if task := opt.task; task != nil && tg.ctx != nil {
+		// 任务的ctx同时跟随任务组的ctx
+		// The ctx of the task also follows the group ctx
+		opt.task = func(ctx context.Context) error {
+			ctx, cancel := context.WithCancelCause(ctx)
+			defer cancel(nil)
+			stop := context.AfterFunc(tg.ctx, func() {
+				cancel(context.Cause(tg.ctx))
+			})
+			defer stop()
+			return task(ctx)
+		}
+	}
+	opt.setOnEnd(func(error) {
+		tg.wg.Done()
+	})
+	parent := tg.parent
+	if parent == nil {
+		parent = context.Background()
+	}
+	if err := tg.lp.AddTaskContext(parent, opt); err != nil {
+		opt.end(err)
+	}
+}
+
+// record 记录任务最终的错误
+// record stores the final error of a task.
+func (tg *TaskGroup) record(err error) {
+	if err == nil {
+		return
+	}
+	tg.mutex.Lock()
+	tg.errs = append(tg.errs, err)
+	first := len(tg.errs) == 1
+	tg.mutex.Unlock()
+	if first && tg.cancelOnError && tg.cancel != nil {
+		tg.cancel(err)
+	}
+}
+
+// Err 返回目前为止任务的错误
+// Err returns the errors of the tasks so far.
+func (tg *TaskGroup) Err() error {
+	tg.mutex.Lock()
+	defer tg.mutex.Unlock()
+	if len(tg.errs) == 0 {
+		return nil
+	}
+	if tg.firstError {
+		return tg.errs[0]
+	}
+	return errors.Join(tg.errs...)
+}
+
 func (tg *TaskGroup) Done() {
 	tg.wg.Done()
 }
 
-func (tg *TaskGroup) Wait() {
+// Wait 等待所有任务完成，返回任务最终的错误，默认使用errors.Join合并，设置WithFirstError时只返回第一个
+// Wait waits for all tasks and returns their final errors, joined with errors.Join or only the first one with WithFirstError.
+func (tg *TaskGroup) Wait() error {
 	tg.wg.Wait()
+	if tg.cancel != nil {
+		tg.cancel(context.Canceled)
+	}
+	return tg.Err()
 }
@@ -0,0 +1,89 @@
+package litepool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitIdle 等待协程池中没有未完成的任务
+// waitIdle waits until the pool has no unfinished task.
+func waitIdle(t *testing.T, lp *ListPool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for lp.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d tasks still pending", lp.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestTaskOptionsReuse 同一个TaskOptions在上一次提交结束后再次提交时，每次提交都正常结束
+// TestTaskOptionsReuse ends every submission properly when a TaskOptions is submitted again after the previous submission finished.
+func TestTaskOptionsReuse(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("SubmitTask", func(t *testing.T) {
+		lp := NewPool(2, 2)
+		defer lp.Close()
+		opt := new(TaskOptions)
+		for i := 0; i < 3; i++ {
+			i := i
+			fu := SubmitTask(lp, opt, func(ctx context.Context) (int, error) { return i, nil })
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			v, err := fu.Get(ctx)
+			cancel()
+			if v != i || err != nil {
+				t.Fatalf("submission %d: %d %v", i, v, err)
+			}
+			waitIdle(t, lp)
+		}
+	})
+
+	t.Run("fixed-count group", func(t *testing.T) {
+		lp := NewPool(2, 2)
+		defer lp.Close()
+		tg := lp.NewTaskGroup(2)
+		opt := tg.NewTaskOptions().SetTask(func() error { return errBoom }).
+			SetOnError(func(h *ErrHandle, g *TaskGroup, err error) { g.Done() })
+		for i := 0; i < 2; i++ {
+			if err := lp.AddTask(opt); err != nil {
+				t.Fatal(err)
+			}
+			waitIdle(t, lp)
+		}
+		tg.Wait()
+		var joined interface{ Unwrap() []error }
+		if err := tg.Err(); !errors.As(err, &joined) || len(joined.Unwrap()) != 2 {
+			t.Fatalf("group recorded %v, want 2 errors", err)
+		}
+	})
+
+	t.Run("GoTask", func(t *testing.T) {
+		lp := NewPool(2, 2)
+		defer lp.Close()
+		tg := lp.NewTaskGroupContext(context.Background())
+		opt := tg.NewTaskOptions().SetTask(func() error { return nil })
+		for i := 0; i < 3; i++ {
+			tg.GoTask(opt)
+			waitIdle(t, lp)
+		}
+		done := make(chan error, 1)
+		go func() { done <- tg.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Wait did not return")
+		}
+		// GoTask的Done只属于那一次提交，之后直接用AddTask提交不会再次执行Done
+		// The Done of GoTask belongs to that submission only, a later plain AddTask does not call it again
+		if err := lp.AddTask(opt); err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(t, lp)
+	})
+}
@@ -1,10 +1,16 @@
 package litepool
 
+import "context"
+
 // 定义一些task接口
 type TaskExec interface {
 	Exec() error
 }
 
+type TaskExecContext interface {
+	Exec(ctx context.Context) error
+}
+
 type TaskOnSuccess interface {
 	OnSuccess()
 }
@@ -1,14 +1,20 @@
 package litepool
 
 import (
+	"context"
+	"sync/atomic"
 	"time"
 )
 
-// TaskOptions 结构体定义了任务的选项和回调
-// The TaskOptions structure defines options and callbacks for tasks.
+// TaskOptions 结构体定义了任务的选项和回调。每次提交的状态（任务ID、入队序号等）也保存在其中，
+// 因此同一个TaskOptions在上一次提交最终结束之前不能再次提交，需要同时提交多次时为每次提交创建一个TaskOptions
+// The TaskOptions structure defines options and callbacks for tasks. The state of a submission (task ID, enqueue sequence and so on) lives in it too,
+// so a TaskOptions must not be submitted again before its previous submission has finished, create one per submission to submit it several times at once.
 type TaskOptions struct {
-	task func() error // 需要执行的任务
+	task func(context.Context) error // 需要执行的任务
 	// Task to be executed.
+	execTimeout time.Duration // 任务执行的超时时间，为0时不限制
+	// Execution timeout of the task, zero means no limit.
 	onSuccess func() // 任务成功执行后的回调
 	// Callback after the task is successfully executed.
 	onError func(*ErrHandle, *TaskGroup, error) // 任务执行错误的回调
@@ -21,9 +27,53 @@ type TaskOptions struct {
 	// Waiting time to add a new task.
 	reNum int // 任务的重试次数
 	// Retry count for the task.
+	retry *RetryPolicy // 任务失败后的重试方式
+	// How the task is retried after a failure.
+	classRetry map[ErrorClass]*RetryPolicy // 按错误类别设置的重试方式
+	// Retry policies per error class.
+	classifier ErrorClassifier // 任务的错误分类方式
+	// Error classifier of the task.
+	attempt int // 已经开始的重试次数
+	// Number of retries started so far.
+	retrying bool // 是否正在等待重新提交
+	// Whether the task is waiting to be resubmitted.
+	firstSubmitted time.Time // 第一次提交的时间，用于RetryPolicy.MaxElapsed
+	// Time of the first submission, used for RetryPolicy.MaxElapsed.
+	reload *RetryPolicy // ErrReload使用的重试方式，优先于retry
+	// Retry policy used by ErrReload, takes precedence over retry.
+	afterRetry func(error) // ErrReload的afterFunc，设置后重试的结果只交给它
+	// afterFunc of ErrReload, once set the outcome of the retries only goes to it.
+	attempts []DeadLetterAttempt // 设置了死信队列时每一次执行的记录
+	// Record of every run when a dead-letter sink is set.
+	key string // 任务的键，键相同的任务按顺序一个接一个执行
+	// Key of the task, tasks with the same key run one at a time in order.
+	inflight <-chan struct{} // 执行超时后仍在运行的有键任务返回时关闭，在此之前不交出键也不开始重试
+	// Closed when a keyed task still running after its exec timeout returns, the key is not passed on and no retry starts before that.
+	priority int // 任务的优先级，越大越先执行
+	// Priority of the task, higher runs first.
+	seq uint64 // 入队序号
+	// Enqueue sequence.
+	queuedAt time.Duration // 相对于协程池创建时间的入队时间
+	// Enqueue time relative to the pool creation.
+	submitted time.Time // 调用提交方法的时间，用于统计排队等待的时间
+	// Time the task was submitted, used for the queue wait histogram.
+	id uint64 // 提交时分配的任务ID
+	// Task ID assigned on submission.
+	name string // 任务的名称，用于pprof标签、runtime/trace、日志和事件
+	// Name of the task, used for pprof labels, runtime/trace, logs and events.
+	labels map[string]string // 任务的pprof标签
+	// pprof labels of the task.
+	traceCtx context.Context // Tracer.OnSubmit返回的ctx
+	// ctx returned by Tracer.OnSubmit.
 	autoDone bool // 是否自动完成任务
 	// Whether to automatically finish the task.
-	tg *TaskGroup
+	tg       *TaskGroup
+	onFinish func(error) // 任务最终结束或被放弃时的内部回调，tg.NewTaskOptions用它记录任务组的错误
+	// Internal callback when the task is finished for good or abandoned, tg.NewTaskOptions uses it to record the group's errors.
+	onEnd func(error) // 只属于本次提交的内部回调，由SubmitTask、GoTask和周期任务设置，调用后清除
+	// Internal callback of the current submission only, set by SubmitTask, GoTask and recurring runs and cleared once called.
+	ended int32 // 本次提交是否已经结束，每次新的提交时重置
+	// Whether the current submission has ended, reset by every new submission.
 }
 
 // ErrHandle 结构体定义了错误处理的方式
@@ -35,58 +85,148 @@ type ErrHandle struct {
 	// Retry count for the task.
 	lp *ListPool // 对应的协程池
 	// Corresponding goroutine pool.
+	worker int64 // 执行任务的协程
+	// Goroutine that ran the task.
+	err error // 触发onError的错误
+	// Error that triggered onError.
+	class ErrorClass // err的类别
+	// Class of err.
+	attempt int // 出错的是第几次执行，第一次为1
+	// Which run failed, 1 for the first one.
+	scheduled bool // ErrReload是否已经安排了重试
+	// Whether ErrReload has scheduled a retry.
 }
 
+// Attempt 返回出错的是第几次执行，第一次为1，重试用完后为最后一次重试的序号加1
+// Attempt returns which run of the task failed, 1 for the first run, once the retries run out it is the last retry plus one.
+func (eh *ErrHandle) Attempt() int {
+	return eh.attempt
+}
+
+// LastErr 返回最后一次执行的错误，即传给onError的错误
+// LastErr returns the error of the last run, the one passed to onError.
+func (eh *ErrHandle) LastErr() error {
+	return eh.err
+}
+
+// Class 返回最后一次执行的错误的类别
+// Class returns the class of the error of the last run.
+func (eh *ErrHandle) Class() ErrorClass {
+	return eh.class
+}
+
+// ErrReload 重试出错的任务，reNum<1时重试到没有错误为止，ClassPermanent的错误不会重试。
+// 重试不会在当前协程中执行，而是按照错误类别对应的重试方式（没有时为DefaultRetryPolicy）等待后重新交给协程池。
+// 重试的结果只交给afterFunc，成功时设置了SetAutoDone的任务组同样会完成。
+// ErrReload retries the failed task, until there is no error when reNum<1, ClassPermanent errors are not retried.
+// Retries do not run on the current goroutine, they are handed back to the pool after waiting according to the retry policy
+// of the error's class, DefaultRetryPolicy when there is none.
+// The outcome of the retries only goes to afterFunc, and SetAutoDone groups are marked done on success as well.
 func (eh *ErrHandle) ErrReload(reNum int, afterFunc func(error)) {
-	// 任务发生错误回调的重试，次数为-1的话会请求到error为nil为止
-	// Retry the task when an error callback occurs. If the retry count is -1, it will retry until error is nil.
-	// 由于任务失败回调的时候没有done 所以这里可以done
-	// Since there's no "done" during the task failure callback, it can be done here.
-	//n := <-eh.lp.idleRun // 取出一个可以执行任务的协程
-	// Fetch a goroutine that can execute the task.
-	var err error
-	defer func() {
-		// 记得收回这个占用线程
-		if afterFunc != nil {
-			afterFunc(err)
-		}
-		if eh.opt.autoDone && err == nil {
-			eh.opt.tg.wg.Done()
-		}
-		// Remember to reclaim the occupied thread.
-		//eh.lp.idleRun <- n // 完成后释放
-		// Release after completion.
-	}()
-	if reNum < 1 { // 当重试次数<1则为无限
-		// If the retry count is less than 1, it means infinite retries.
-		for i := 1; i > -1; i++ {
-			//log.Println(fmt.Sprintf("重试次数%v,重试第%v次", reNum, i))
-			// Logging the retry count and the current attempt number.
-			err = eh.opt.task()
-			if err == nil {
-				return
-			}
-		}
+	f := eh.opt
+	p := DefaultRetryPolicy()
+	if rp := eh.lp.retryPolicy(f, eh.class); rp != nil {
+		p = *rp
+	}
+	p.MaxAttempts = 0
+	if reNum >= 1 {
+		p.MaxAttempts = f.attempt + 1 + reNum
+	}
+	f.reload = &p
+	f.afterRetry = afterFunc
+	if f.afterRetry == nil {
+		f.afterRetry = func(error) {}
 	}
-	for i := 1; i <= reNum; i++ {
-		//log.Println(fmt.Sprintf("重试次数%v,重试第%v次", reNum, i))
-		// Logging the retry count and the current attempt number.
-		err = eh.opt.task()
-		if err == nil {
-			return
-		}
+	if eh.lp.retryLater(eh.worker, f, eh.err) {
+		eh.scheduled = true
+		return
 	}
-	return
+	// 错误不可重试、协程池已经关闭或超过了MaxElapsed，不再重试
+	// The error is permanent, the pool has closed or MaxElapsed has passed, no retry
+	f.afterRetry(eh.err)
+}
+
+// end 在任务最终结束时调用onFinish和本次提交的onEnd，每次提交只有第一次调用有效
+// end calls onFinish and the onEnd of the current submission once the task is finished for good, only the first call per submission has an effect.
+func (t *TaskOptions) end(err error) {
+	if !atomic.CompareAndSwapInt32(&t.ended, 0, 1) {
+		return
+	}
+	if t.onFinish != nil {
+		t.onFinish(err)
+	}
+	if f := t.onEnd; f != nil {
+		// 清除后再调用，之后直接用AddTask提交同一个TaskOptions不会再次调用它
+		// Cleared before the call so that a later plain AddTask of the same TaskOptions does not call it again
+		t.onEnd = nil
+		f(err)
+	}
+}
+
+// clone 复制任务用于一次新的提交，入队信息、结束状态和onEnd不会被复制
+// clone copies the task for a new submission, the enqueue state, the ended flag and onEnd are not copied.
+func (t *TaskOptions) clone() *TaskOptions {
+	return &TaskOptions{
+		task:        t.task,
+		execTimeout: t.execTimeout,
+		onSuccess:   t.onSuccess,
+		onError:     t.onError,
+		onComplete:  t.onComplete,
+		onTimeout:   t.onTimeout,
+		waitTimeOut: t.waitTimeOut,
+		reNum:       t.reNum,
+		retry:       t.retry,
+		classRetry:  t.classRetry,
+		classifier:  t.classifier,
+		priority:    t.priority,
+		key:         t.key,
+		name:        t.name,
+		labels:      t.labels,
+		autoDone:    t.autoDone,
+		tg:          t.tg,
+		onFinish:    t.onFinish,
+	}
+}
+
+// setOnEnd 为一次新的提交设置onEnd，替换上一次提交的回调并重置结束状态
+// setOnEnd sets onEnd for a new submission, replacing the callback of the previous one and resetting the ended flag.
+func (t *TaskOptions) setOnEnd(f func(error)) {
+	t.onEnd = f
+	atomic.StoreInt32(&t.ended, 0)
 }
 
 func (tg *TaskGroup) NewTaskOptions() *TaskOptions {
-	return &TaskOptions{tg: tg}
+	t := &TaskOptions{tg: tg}
+	// 记录任务最终的错误，由Wait返回
+	// Record the final error of the task, returned by Wait
+	t.onFinish = tg.record
+	return t
 }
 func (t *TaskOptions) SetTask(f func() error) *TaskOptions {
+	t.task = func(context.Context) error {
+		return f()
+	}
+	return t
+}
+
+// SetTaskContext 设置接收ctx的任务，ctx在协程池关闭或达到SetExecTimeout设置的时间后取消
+// SetTaskContext sets a task that receives a ctx, cancelled when the pool shuts down or the SetExecTimeout duration passes.
+func (t *TaskOptions) SetTaskContext(f func(ctx context.Context) error) *TaskOptions {
 	t.task = f
 	return t
 }
 
+// SetExecTimeout 设置任务执行的超时时间，超时后ctx被取消，onError收到ErrExecTimeout，
+// 协程不再等待这个任务而是继续处理下一个任务。设置了SetKey的任务在返回之前仍然占用键和空位，
+// 同一个键的下一个任务和它的重试要等它返回后才开始，因此任务需要在ctx取消后尽快返回
+// SetExecTimeout sets how long the task may run, on timeout the ctx is cancelled, onError receives ErrExecTimeout
+// and the goroutine stops waiting for the task and moves on to the next one. A task with SetKey keeps its key and its slot until it returns,
+// the next task of the key and its own retry only start after that, so the task should return soon after ctx is cancelled.
+func (t *TaskOptions) SetExecTimeout(d time.Duration) *TaskOptions {
+	t.execTimeout = d
+	return t
+}
+
 func (t *TaskOptions) SetOnSuccess(f func()) *TaskOptions {
 	t.onSuccess = f
 	return t
@@ -111,6 +251,38 @@ func (t *TaskOptions) SetAddTimeout(duration time.Duration) *TaskOptions {
 	return t
 }
 
+// SetName 设置任务的名称，在pprof标签litepool.task、runtime/trace的task、日志和事件中使用
+// SetName names the task, the name shows up as the litepool.task pprof label, the runtime/trace task, in logs and in events.
+func (t *TaskOptions) SetName(name string) *TaskOptions {
+	t.name = name
+	return t
+}
+
+// SetLabels 设置执行任务时附加的pprof标签，可以在CPU profile中按标签筛选
+// SetLabels sets pprof labels applied while the task runs, so CPU profiles can be filtered by them.
+func (t *TaskOptions) SetLabels(labels map[string]string) *TaskOptions {
+	t.labels = make(map[string]string, len(labels))
+	for k, v := range labels {
+		t.labels[k] = v
+	}
+	return t
+}
+
+// ID 返回提交时分配的任务ID，与Event.TaskID相同，提交前为0
+// ID returns the task ID assigned on submission, the same as Event.TaskID, 0 before submission.
+func (t *TaskOptions) ID() uint64 {
+	return t.id
+}
+
+// SetPriority 设置任务的优先级，默认为0，越大越先执行，排队时间越长优先级越高。
+// 协程池已满时提交也按优先级等待空位，高优先级的任务会越过先提交的低优先级任务。
+// SetPriority sets the priority of the task, 0 by default, higher runs first and waiting raises it over time.
+// On a full pool submissions also wait for a slot by priority, so an urgent task overtakes low priority ones submitted earlier.
+func (t *TaskOptions) SetPriority(p int) *TaskOptions {
+	t.priority = p
+	return t
+}
+
 func (t *TaskOptions) SetOnAddTimeout(f func()) *TaskOptions {
 	t.onTimeout = f
 	return t
@@ -1,6 +1,10 @@
 package litepool
 
 func (t *TaskOptions) SetTaskWithInterface(f TaskExec) *TaskOptions {
+	return t.SetTask(f.Exec)
+}
+
+func (t *TaskOptions) SetTaskContextWithInterface(f TaskExecContext) *TaskOptions {
 	t.task = f.Exec
 	return t
 }
@@ -0,0 +1,169 @@
+package litepool
+
+import (
+	"container/heap"
+	"time"
+)
+
+// taskQueue 是每个协程专属的任务队列，按照优先级出队，同一优先级先进先出。
+// 设置了aging时，每排队aging这么久优先级相当于提高1，低优先级的任务不会一直排不到。
+// 队列由lp.mutex保护。
+// taskQueue is the dedicated task queue of a goroutine, tasks leave it by priority and in FIFO order within a priority.
+// With aging set, every aging spent in the queue counts as one extra priority level, so low priority tasks cannot starve.
+// The queue is guarded by lp.mutex.
+type taskQueue struct {
+	items []*TaskOptions
+	aging time.Duration
+	// 有新任务时通知协程，容量为1
+	// Notifies the goroutine of new tasks, capacity 1
+	signal chan struct{}
+}
+
+func newTaskQueue(size int, aging time.Duration) *taskQueue {
+	return &taskQueue{
+		items:  make([]*TaskOptions, 0, size),
+		aging:  aging,
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (q *taskQueue) Len() int { return len(q.items) }
+
+func (q *taskQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	return ahead(q.aging, a.priority, a.queuedAt, a.seq, b.priority, b.queuedAt, b.seq)
+}
+
+// ahead 判断优先级为pa、在qa时排队、序号为sa的一方是否排在另一方前面，任务队列和等待空位的提交使用同样的顺序
+// ahead reports whether the side with priority pa, queued at qa with sequence sa goes before the other, task queues and submissions waiting for a slot share this order.
+func ahead(aging time.Duration, pa int, qa time.Duration, sa uint64, pb int, qb time.Duration, sb uint64) bool {
+	if aging > 0 {
+		// 优先级加上排队时间折算的等级，两个任务排队时间的差不随时间变化，所以可以直接比较入队时间
+		// Priority plus the levels gained while waiting, the difference between two tasks does not change over time so the enqueue times are compared directly
+		ka := float64(pa) - float64(qa)/float64(aging)
+		kb := float64(pb) - float64(qb)/float64(aging)
+		if ka != kb {
+			return ka > kb
+		}
+	} else if pa != pb {
+		return pa > pb
+	}
+	return sa < sb
+}
+
+func (q *taskQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *taskQueue) Push(x interface{}) { q.items = append(q.items, x.(*TaskOptions)) }
+
+func (q *taskQueue) Pop() interface{} {
+	n := len(q.items)
+	f := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return f
+}
+
+// push 将任务放入队列并通知协程
+// push queues the task and notifies the goroutine.
+func (q *taskQueue) push(f *TaskOptions) {
+	heap.Push(q, f)
+	q.wake()
+}
+
+// wake 通知协程查看队列，已经有通知时忽略
+// wake tells the goroutine to look at its queue, ignored when a notice is already pending.
+func (q *taskQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop 取出优先级最高的任务，队列为空时返回nil
+// pop takes the task with the highest priority, nil when the queue is empty.
+func (q *taskQueue) pop() *TaskOptions {
+	if len(q.items) == 0 {
+		return nil
+	}
+	return heap.Pop(q).(*TaskOptions)
+}
+
+// slotWaiter 是一个正在等待空位的提交
+// slotWaiter is a submission waiting for a free slot.
+type slotWaiter struct {
+	priority int
+	queuedAt time.Duration // 相对于协程池创建时间的开始等待时间
+	// Time the wait started, relative to the creation of the pool.
+	seq   uint64
+	index int // 在waiterQueue中的位置，取得空位后为-1
+	// Position in the waiterQueue, -1 once a slot has been handed over.
+	ready chan struct{} // 取得空位时关闭
+	// Closed when a slot is handed over.
+}
+
+// waiterQueue 是等待空位的提交组成的堆，空位释放时交给排在最前面的提交，顺序与taskQueue相同。
+// 队列由lp.mutex保护。
+// waiterQueue is a heap of submissions waiting for a free slot, a released slot goes to the one in front, in the same order as taskQueue.
+// The queue is guarded by lp.mutex.
+type waiterQueue struct {
+	items []*slotWaiter
+	aging time.Duration
+	seq   uint64
+}
+
+func (q *waiterQueue) Len() int { return len(q.items) }
+
+func (q *waiterQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	return ahead(q.aging, a.priority, a.queuedAt, a.seq, b.priority, b.queuedAt, b.seq)
+}
+
+func (q *waiterQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+func (q *waiterQueue) Push(x interface{}) {
+	w := x.(*slotWaiter)
+	w.index = len(q.items)
+	q.items = append(q.items, w)
+}
+
+func (q *waiterQueue) Pop() interface{} {
+	n := len(q.items)
+	w := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	w.index = -1
+	return w
+}
+
+// wait 加入一个优先级为priority的等待者
+// wait adds a waiter with the given priority.
+func (q *waiterQueue) wait(priority int, now time.Duration) *slotWaiter {
+	q.seq++
+	w := &slotWaiter{priority: priority, queuedAt: now, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(q, w)
+	return w
+}
+
+// hand 把一个空位交给排在最前面的等待者，没有等待者时返回false
+// hand gives a slot to the waiter in front, false when nobody is waiting.
+func (q *waiterQueue) hand() bool {
+	if len(q.items) == 0 {
+		return false
+	}
+	close(heap.Pop(q).(*slotWaiter).ready)
+	return true
+}
+
+// leave 移除放弃等待的等待者，它已经取得空位时返回false
+// leave removes a waiter that gave up, false when it has already been handed a slot.
+func (q *waiterQueue) leave(w *slotWaiter) bool {
+	if w.index < 0 {
+		return false
+	}
+	heap.Remove(q, w.index)
+	return true
+}
@@ -0,0 +1,107 @@
+package litepool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTaskQueueOrder 任务按优先级出队，同一优先级先进先出，aging让排队久的任务提前
+// TestTaskQueueOrder pops tasks by priority and FIFO within a priority, aging moves tasks that waited long to the front.
+func TestTaskQueueOrder(t *testing.T) {
+	type item struct {
+		priority int
+		queuedAt time.Duration
+	}
+	tests := []struct {
+		name  string
+		aging time.Duration
+		items []item
+		want  []int // 出队顺序，按items中的下标
+		// Pop order as indices into items.
+	}{
+		{"fifo", 0, []item{{0, 0}, {0, 1}, {0, 2}}, []int{0, 1, 2}},
+		{"priority", 0, []item{{0, 0}, {2, 1}, {1, 2}, {2, 3}}, []int{1, 3, 2, 0}},
+		{"negative priority", 0, []item{{-1, 0}, {0, 1}}, []int{1, 0}},
+		{"no aging", 0, []item{{0, 0}, {1, 10 * time.Second}}, []int{1, 0}},
+		{"aged past a higher priority", time.Second, []item{{0, 0}, {1, 2 * time.Second}}, []int{0, 1}},
+		{"not aged enough", time.Second, []item{{0, 0}, {2, 1500 * time.Millisecond}}, []int{1, 0}},
+		{"aged to a tie", time.Second, []item{{1, time.Second}, {0, 0}}, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTaskQueue(len(tt.items), tt.aging)
+			for i, it := range tt.items {
+				q.push(&TaskOptions{priority: it.priority, queuedAt: it.queuedAt, seq: uint64(i + 1), name: string(rune('0' + i))})
+			}
+			for _, want := range tt.want {
+				f := q.pop()
+				if got := int(f.name[0] - '0'); got != want {
+					t.Fatalf("popped %d, want %d", got, want)
+				}
+			}
+			if q.pop() != nil {
+				t.Fatal("queue not empty")
+			}
+		})
+	}
+}
+
+// TestPriorityOnFullPool 协程池已满时，空位先交给优先级高的提交
+// TestPriorityOnFullPool hands a free slot to the highest priority submission first when the pool is full.
+func TestPriorityOnFullPool(t *testing.T) {
+	lp := NewPool(1, 0, WithPriorityAging(0))
+	defer lp.Close()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	lp.AddTask(new(TaskOptions).SetTask(func() error {
+		close(started)
+		<-block
+		return nil
+	}))
+	<-started
+
+	var mutex sync.Mutex
+	var order []int
+	var submitted sync.WaitGroup
+	submit := func(priority int) {
+		submitted.Add(1)
+		go func() {
+			defer submitted.Done()
+			lp.AddTask(new(TaskOptions).SetPriority(priority).SetTask(func() error {
+				mutex.Lock()
+				order = append(order, priority)
+				mutex.Unlock()
+				return nil
+			}))
+		}()
+		// 等到提交开始等待空位，保证提交的先后顺序
+		// Wait until the submission is waiting for a slot so that the submission order is fixed
+		for waiting := 0; waiting == 0; {
+			time.Sleep(time.Millisecond)
+			lp.mutex.Lock()
+			for _, w := range lp.waiters.items {
+				if w.priority == priority {
+					waiting++
+				}
+			}
+			lp.mutex.Unlock()
+		}
+	}
+	submit(0)
+	submit(1)
+	submit(5)
+	submit(2)
+	close(block)
+	submitted.Wait()
+	lp.Shutdown(context.Background(), ShutdownDrain)
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := []int{5, 2, 1, 0}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("ran in order %v, want %v", order, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package litepool
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+)
+
+// TaskInfo 是交给Tracer的任务信息，提交时Worker为-1
+// TaskInfo describes a task to a Tracer, Worker is -1 on submission.
+type TaskInfo struct {
+	ID        uint64
+	Name      string
+	Labels    map[string]string
+	Pool      string
+	Worker    int64
+	Priority  int
+	Submitted time.Time
+}
+
+// Tracer 用于接入OpenTelemetry等追踪系统，把提交者的ctx带到执行任务的协程。
+// OnSubmit在提交任务的协程中调用，返回的ctx被保存在任务中；OnStart在执行任务前调用，
+// 收到的ctx是OnSubmit返回的ctx（只保留值，不会被提交者取消），返回的ctx中的值会传给任务，end在任务结束时调用。
+// Tracer plugs in tracing systems such as OpenTelemetry, carrying the submitter's ctx over to the goroutine that runs the task.
+// OnSubmit is called on the submitting goroutine and the ctx it returns is kept with the task; OnStart is called before the task runs
+// with that ctx (values only, the submitter cannot cancel it), the values of the ctx it returns reach the task, and end is called when the task ends.
+type Tracer interface {
+	OnSubmit(ctx context.Context, t TaskInfo) context.Context
+	OnStart(ctx context.Context, t TaskInfo) (context.Context, func(err error))
+}
+
+// WithTracer 设置协程池的Tracer
+// WithTracer sets the Tracer of the pool.
+func WithTracer(t Tracer) PoolOption {
+	return func(lp *ListPool) {
+		lp.tracer = t
+	}
+}
+
+// taskCtx 的取消来自协程池，值来自Tracer
+// taskCtx is cancelled by the pool and takes its values from the Tracer.
+type taskCtx struct {
+	context.Context
+	values context.Context
+}
+
+func (c taskCtx) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+func (lp *ListPool) taskInfo(n int64, f *TaskOptions) TaskInfo {
+	return TaskInfo{
+		ID:        f.id,
+		Name:      f.name,
+		Labels:    f.labels,
+		Pool:      lp.name,
+		Worker:    n,
+		Priority:  f.priority,
+		Submitted: f.submitted,
+	}
+}
+
+// trace 在提交时调用Tracer，保存提交者的ctx
+// trace calls the Tracer on submission and keeps the submitter's ctx.
+func (lp *ListPool) trace(ctx context.Context, f *TaskOptions) {
+	if lp.tracer == nil {
+		return
+	}
+	f.traceCtx = lp.tracer.OnSubmit(context.WithoutCancel(ctx), lp.taskInfo(-1, f))
+}
+
+// safeInvoke 与invoke相同，但将panic转换为PanicError返回
+// safeInvoke is like invoke but returns a panic as a PanicError.
+func (lp *ListPool) safeInvoke(n int64, f *TaskOptions) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = asPanicError(r)
+		}
+	}()
+	return lp.invoke(n, f)
+}
+
+// invoke 在协程n中执行任务，任务带有pprof标签并处于runtime/trace的task和region中，设置了Tracer时同时调用它
+// invoke runs the task on goroutine n under pprof labels and a runtime/trace task and region, calling the Tracer when one is set.
+func (lp *ListPool) invoke(n int64, f *TaskOptions) (err error) {
+	ctx := lp.ctx
+	if lp.tracer != nil {
+		values := f.traceCtx
+		if values == nil {
+			values = context.Background()
+		}
+		values, end := lp.tracer.OnStart(values, lp.taskInfo(n, f))
+		ctx = taskCtx{Context: lp.ctx, values: values}
+		defer func() {
+			if r := recover(); r != nil {
+				pe := asPanicError(r)
+				end(pe)
+				panic(pe)
+			}
+			end(err)
+		}()
+	}
+
+	name := f.name
+	if name == "" {
+		name = "litepool.task"
+	}
+	ctx, task := trace.NewTask(ctx, name)
+	defer task.End()
+
+	labels := make([]string, 0, 6+2*len(f.labels))
+	labels = append(labels, "litepool.task", name, "litepool.worker", strconv.FormatInt(n, 10))
+	if lp.name != "" {
+		labels = append(labels, "litepool.pool", lp.name)
+	}
+	for k, v := range f.labels {
+		labels = append(labels, k, v)
+	}
+	pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+		defer trace.StartRegion(ctx, "litepool.exec").End()
+		err = lp.call(ctx, f)
+	})
+	return err
+}